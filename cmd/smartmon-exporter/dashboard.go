@@ -0,0 +1,21 @@
+package main
+
+import (
+	"flag"
+	"github.com/milesbxf/smartmon-exporter/pkg/dashboard"
+	"github.com/rs/zerolog/log"
+	"os"
+)
+
+func runDashboard(args []string) {
+	cfg := dashboard.DefaultConfig()
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	fs.StringVar(&cfg.Title, "title", cfg.Title, "The title of the dashboard.")
+	fs.StringVar(&cfg.UID, "uid", cfg.UID, "The UID of the dashboard.")
+	fs.StringVar(&cfg.Job, "job", cfg.Job, "The Prometheus job label of the exporter's scrape targets.")
+	_ = fs.Parse(args)
+
+	if err := dashboard.Write(os.Stdout, dashboard.Generate(cfg)); err != nil {
+		log.Fatal().Err(err).Msg("failed to write dashboard")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configureLogging sets the global log level and output format: json, console or logfmt.
+func configureLogging(level, format string) error {
+	l, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	zerolog.SetGlobalLevel(l)
+
+	var w io.Writer
+	switch format {
+	case "json":
+		zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+		w = os.Stderr
+	case "console":
+		zerolog.TimeFieldFormat = time.RFC3339
+		w = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+	case "logfmt":
+		zerolog.TimeFieldFormat = time.RFC3339
+		w = logfmtWriter(os.Stderr)
+	default:
+		return fmt.Errorf("invalid log format %q, must be json, console or logfmt", format)
+	}
+	log.Logger = zerolog.New(w).With().Timestamp().Logger()
+	return nil
+}
+
+// logfmtWriter formats log events as logfmt key=value pairs.
+func logfmtWriter(out io.Writer) zerolog.ConsoleWriter {
+	value := func(i interface{}) string {
+		return fmt.Sprintf("%s", i)
+	}
+	quoted := func(i interface{}) string {
+		if i == nil {
+			return `""`
+		}
+		return strconv.Quote(fmt.Sprint(i))
+	}
+	// ConsoleWriter passes string field values containing spaces or quotes already quoted, but not those containing
+	// "=", nor other values, which it formats as JSON
+	fieldValue := func(i interface{}) string {
+		if s, ok := i.(string); ok && strings.HasPrefix(s, `"`) {
+			return s
+		}
+		s := value(i)
+		if s == "" || strings.IndexFunc(s, func(r rune) bool { return r <= ' ' || r == '=' || r == '"' || r == '\\' }) >= 0 {
+			return strconv.Quote(s)
+		}
+		return s
+	}
+	return zerolog.ConsoleWriter{
+		Out:                 out,
+		NoColor:             true,
+		PartsOrder:          []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, zerolog.MessageFieldName},
+		FormatTimestamp:     func(i interface{}) string { return "time=" + value(i) },
+		FormatLevel:         func(i interface{}) string { return "level=" + value(i) },
+		FormatMessage:       func(i interface{}) string { return "msg=" + quoted(i) },
+		FormatFieldName:     func(i interface{}) string { return value(i) + "=" },
+		FormatFieldValue:    fieldValue,
+		FormatErrFieldName:  func(i interface{}) string { return value(i) + "=" },
+		FormatErrFieldValue: fieldValue,
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLogfmtWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		event func(e *zerolog.Event) *zerolog.Event
+		want  string
+	}{
+		{"plain", func(e *zerolog.Event) *zerolog.Event { return e.Str("device", "/dev/sda") }, "device=/dev/sda"},
+		{"space", func(e *zerolog.Event) *zerolog.Event { return e.Str("model", "Seagate Exos") }, `model="Seagate Exos"`},
+		{"equals", func(e *zerolog.Event) *zerolog.Event { return e.Str("command", "a=b") }, `command="a=b"`},
+		{"quote", func(e *zerolog.Event) *zerolog.Event { return e.Str("serial", `a"b`) }, `serial="a\"b"`},
+		{"empty", func(e *zerolog.Event) *zerolog.Event { return e.Str("serial", "") }, `serial=""`},
+		{"number", func(e *zerolog.Event) *zerolog.Event { return e.Int("failures", 3) }, "failures=3"},
+		{"array", func(e *zerolog.Event) *zerolog.Event { return e.Strs("groups", []string{"health", "logs"}) }, `groups="[\"health\",\"logs\"]"`},
+		{"error", func(e *zerolog.Event) *zerolog.Event { return e.Err(errors.New("exit status 2")) }, `error="exit status 2"`},
+		{"error with equals", func(e *zerolog.Event) *zerolog.Event { return e.Err(errors.New("code=2")) }, `error="code=2"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger := zerolog.New(logfmtWriter(buf))
+			tt.event(logger.Info()).Msg("polled device")
+			got := buf.String()
+			if !strings.Contains(got, `msg="polled device"`) {
+				t.Errorf("got %q, want a quoted msg", got)
+			}
+			if !strings.Contains(got, " "+tt.want) {
+				t.Errorf("got %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,20 +1,78 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/milesbxf/smartmon-exporter/pkg/collector"
+	"github.com/milesbxf/smartmon-exporter/pkg/events"
+	"github.com/milesbxf/smartmon-exporter/pkg/history"
+	"github.com/milesbxf/smartmon-exporter/pkg/notify"
+	"github.com/milesbxf/smartmon-exporter/pkg/otlp"
+	"github.com/milesbxf/smartmon-exporter/pkg/output"
+	"github.com/milesbxf/smartmon-exporter/pkg/push"
+	"github.com/milesbxf/smartmon-exporter/pkg/risk"
 	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/milesbxf/smartmon-exporter/pkg/web"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rules":
+			runRules(os.Args[2:])
+			return
+		case "dashboard":
+			runDashboard(os.Args[2:])
+			return
+		}
+	}
+
 	addr := flag.String("listen-address", ":9101", "The address to listen on for HTTP requests.")
 	pollIntervalStr := flag.String("poll-interval", "1m", "The interval between polling for device information.")
+	maxBackoffStr := flag.String("device-max-backoff", "1h", "Maximum interval between polls of a device which keeps failing. Zero disables backoff.")
+	staleTTLStr := flag.String("device-stale-ttl", "15m", "Stop exporting a device's metrics, other than smart_device_up, once it hasn't been polled successfully for this long. Must exceed the poll interval, and should exceed the longest poll schedule interval. Zero disables.")
+	removalTTLStr := flag.String("device-removal-ttl", "24h", "Forget a device which hasn't been polled successfully for this long and is no longer found by smartctl --scan-open. Zero disables.")
+	smartctlTimeoutStr := flag.String("smartctl-timeout", "30s", "Kill smartctl if it runs for longer than this against a device, counting the poll as failed. Zero disables.")
+	readyMissedPolls := flag.Int("ready-missed-polls", 3, "Number of poll intervals without a successful poll after which /-/ready fails. Zero disables the check.")
+	pollSchedule := flag.String("poll-schedule", "", "Path of a JSON file configuring separate poll intervals per group of device information and per device. Everything is polled every poll interval if empty.")
+	scrapeMaxAgeStr := flag.String("scrape-max-age", "0s", "Poll devices whose data is older than this during a scrape, before responding. Zero disables refreshing on scrape.")
+	scrapeTimeoutStr := flag.String("scrape-refresh-timeout", "10s", "Maximum time to spend refreshing devices during a scrape, if Prometheus doesn't send its scrape timeout.")
+	shutdownTimeoutStr := flag.String("shutdown-timeout", "30s", "How long to wait for in-flight requests to complete on shutdown.")
+	historyPath := flag.String("history-path", "", "Path of the database to store device history in. History is disabled if empty.")
+	historyRetentionStr := flag.String("history-retention", "8760h", "How long to keep device history for.")
+	historyCompactAfterStr := flag.String("history-compact-after", "168h", "Age after which device history is thinned out.")
+	historyCompactResolutionStr := flag.String("history-compact-resolution", "1h", "Interval between snapshots kept in thinned out device history. Zero disables thinning, but history older than the retention is still deleted.")
+	eventsRetained := flag.Int("events-retained", 1000, "Number of recent attribute change events to retain.")
+	notifyConfig := flag.String("notify-config", "", "Path of a JSON file configuring webhook notifications on device health transitions.")
+	riskConfig := flag.String("risk-config", "", "Path of a JSON file configuring failure risk factors. Uses built-in defaults if empty.")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP endpoint to push metrics to after every poll: host:port for gRPC, or a base URL for HTTP. Disabled if empty.")
+	otlpProtocol := flag.String("otlp-protocol", "grpc", "OTLP protocol, grpc or http.")
+	otlpInsecure := flag.Bool("otlp-insecure", false, "Disable TLS for OTLP gRPC connections.")
+	otlpHeaders := flag.String("otlp-headers", "", "Comma-separated key=value headers to send with OTLP requests.")
+	otlpTimeoutStr := flag.String("otlp-timeout", "10s", "Timeout for OTLP requests.")
+	pushgatewayURL := flag.String("pushgateway-url", "", "Pushgateway URL to push metrics to after every poll. Disabled if empty.")
+	pushJob := flag.String("push-job", "smartmon", "Job label to push metrics with.")
+	remoteWriteURL := flag.String("remote-write-url", "", "Prometheus remote-write URL to push metrics to after every poll. Disabled if empty.")
+	pushTimeoutStr := flag.String("push-timeout", "10s", "Timeout for each push attempt.")
+	pushRetries := flag.Int("push-retries", 3, "Number of times to retry a failed push.")
+	once := flag.Bool("once", false, "Poll all devices once, write the output, push it to any configured targets and exit. Exits non-zero if any device fails to poll.")
+	outputFormatStr := flag.String("output.format", "prometheus", "Output format for -once: prometheus, influx or json.")
+	outputFile := flag.String("output.file", "", "File to write -once output to, e.g. for a textfile collector. Writes to stdout if empty.")
+	debugRedact := flag.Bool("debug-redact-identifiers", false, "Redact serial numbers and WWNs from raw smartctl output served at /debug/smartctl/.")
+	farmLog := flag.Bool("collect-farm-log", false, "Collect the Seagate FARM log (requires smartctl >= 7.4).")
+	logLevel := flag.String("log.level", "info", "Only log messages with the given severity or above: debug, info, warn or error.")
+	logFormat := flag.String("log.format", "json", "Log format: json, console or logfmt.")
 	flag.Parse()
 
 	pollInterval, err := time.ParseDuration(*pollIntervalStr)
@@ -22,29 +80,324 @@ func main() {
 		log.Fatal().Err(err).Msgf("Could not parse poll interval %s", *pollIntervalStr)
 	}
 
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	maxBackoff, err := time.ParseDuration(*maxBackoffStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse device max backoff %s", *maxBackoffStr)
+	}
+
+	smartctlTimeout, err := time.ParseDuration(*smartctlTimeoutStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse smartctl timeout %s", *smartctlTimeoutStr)
+	}
+	if smartctlTimeout < 0 {
+		log.Fatal().Msgf("smartctl timeout %s must not be negative", smartctlTimeout)
+	}
+
+	scrapeMaxAge, err := time.ParseDuration(*scrapeMaxAgeStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse scrape max age %s", *scrapeMaxAgeStr)
+	}
+	scrapeTimeout, err := time.ParseDuration(*scrapeTimeoutStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse scrape refresh timeout %s", *scrapeTimeoutStr)
+	}
+
+	staleTTL, err := time.ParseDuration(*staleTTLStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse device stale TTL %s", *staleTTLStr)
+	}
+	removalTTL, err := time.ParseDuration(*removalTTLStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse device removal TTL %s", *removalTTLStr)
+	}
+
+	shutdownTimeout, err := time.ParseDuration(*shutdownTimeoutStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse shutdown timeout %s", *shutdownTimeoutStr)
+	}
+
+	historyRetention, err := time.ParseDuration(*historyRetentionStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse history retention %s", *historyRetentionStr)
+	}
+	historyCompactAfter, err := time.ParseDuration(*historyCompactAfterStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse history compact after %s", *historyCompactAfterStr)
+	}
+	historyCompactResolution, err := time.ParseDuration(*historyCompactResolutionStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse history compact resolution %s", *historyCompactResolutionStr)
+	}
+	if historyCompactResolution < 0 {
+		log.Fatal().Msgf("History compact resolution %s must not be negative", historyCompactResolution)
+	}
+
+	otlpTimeout, err := time.ParseDuration(*otlpTimeoutStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse OTLP timeout %s", *otlpTimeoutStr)
+	}
+
+	pushTimeout, err := time.ParseDuration(*pushTimeoutStr)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse push timeout %s", *pushTimeoutStr)
+	}
+
+	outputFormat, err := output.ParseFormat(*outputFormatStr)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid output format")
+	}
+
+	if err := configureLogging(*logLevel, *logFormat); err != nil {
+		log.Fatal().Err(err).Msg("invalid logging configuration")
+	}
+
+	// cancelled on SIGINT or SIGTERM, stopping all background loops
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var wg sync.WaitGroup
+	goRun := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+
+	s := smartctl.New(smartctlTimeout)
+	version, err := s.DetectVersion()
+	if err != nil {
+		log.Fatal().Err(err).Msg("unsupported smartctl")
+	}
+	if *farmLog && !version.AtLeast(smartctl.FarmLogVersion) {
+		log.Warn().
+			Str("version", version.String()).
+			Msgf("FARM log collection requires smartctl >= %s, disabling it", smartctl.FarmLogVersion)
+		*farmLog = false
+	}
+
+	if *eventsRetained < 0 {
+		log.Fatal().Msgf("Number of events retained %d must not be negative", *eventsRetained)
+	}
+	broker := events.NewBroker(*eventsRetained)
+	prometheus.MustRegister(broker)
+	http.Handle("/api/v1/events", web.EventsHandler(broker))
+
+	if *notifyConfig != "" {
+		cfg, err := notify.LoadConfig(*notifyConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load notification config")
+		}
+		n, err := notify.New(*cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to create notifier")
+		}
+		if err := prometheus.Register(n); err != nil {
+			log.Fatal().Err(err).Msg("failed to register notifier")
+		}
+		// buffer enough for the initial state of a large fleet, which is published all at once on the first poll
+		ch, unsubscribe := broker.SubscribeWithInitial(4096)
+		go n.Run(ctx, ch)
+		defer func() {
+			unsubscribe()
+			n.Wait()
+		}()
+	}
+
+	opts := []collector.Option{
+		collector.WithFarmLog(*farmLog),
+		collector.WithEvents(broker),
+		collector.WithReadyMissedPolls(*readyMissedPolls),
+		collector.WithMaxBackoff(maxBackoff),
+		collector.WithStaleness(staleTTL, removalTTL),
+	}
+
+	if *historyPath != "" {
+		store, err := history.Open(*historyPath, history.Options{
+			Retention:         historyRetention,
+			CompactAfter:      historyCompactAfter,
+			CompactResolution: historyCompactResolution,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open history store")
+		}
+		defer func() {
+			if err := store.Close(); err != nil {
+				log.Error().Err(err).Msg("failed to close history store")
+			}
+		}()
+		// retention is enforced by compaction too, so run it even if thinning is disabled
+		compactionInterval := historyCompactResolution
+		if compactionInterval <= 0 {
+			compactionInterval = time.Hour
+		}
+		goRun(func() { store.RunCompaction(ctx, compactionInterval) })
+
+		opts = append(opts, collector.WithHistory(store))
+		http.Handle("/api/v1/history", web.HistoryHandler(store))
+		http.Handle("/api/v1/history/", web.HistoryHandler(store))
+	}
 
-	s := smartctl.New()
+	if *pollSchedule != "" {
+		schedule, err := collector.LoadSchedule(*pollSchedule)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load poll schedule")
+		}
+		opts = append(opts, collector.WithSchedule(*schedule))
+	}
 
-	c, err := collector.New(s, pollInterval)
+	if *riskConfig != "" {
+		cfg, err := risk.LoadConfig(*riskConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load risk config")
+		}
+		scorer, err := risk.New(*cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to create risk scorer")
+		}
+		opts = append(opts, collector.WithRiskScorer(scorer))
+	}
+
+	// registry of only the collector's own metrics, for pushing elsewhere
+	pushRegistry := prometheus.NewRegistry()
+	// in -once mode, metrics are pushed synchronously after the poll rather than in the background when it completes
+	pushes := []func(ctx context.Context) error{}
+
+	if *otlpEndpoint != "" {
+		exporter, err := otlp.New(otlp.Config{
+			Endpoint: *otlpEndpoint,
+			Protocol: otlp.Protocol(*otlpProtocol),
+			Insecure: *otlpInsecure,
+			Headers:  parseHeaders(*otlpHeaders),
+			Timeout:  otlpTimeout,
+		}, pushRegistry)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to create OTLP exporter")
+		}
+		defer exporter.Close()
+		if *once {
+			pushes = append(pushes, func(ctx context.Context) error {
+				ctx, cancel := context.WithTimeout(ctx, otlpTimeout)
+				defer cancel()
+				return exporter.Export(ctx)
+			})
+		} else {
+			goRun(func() { exporter.Run(ctx) })
+			opts = append(opts, collector.WithPollHook(exporter.Trigger))
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to get hostname")
+	}
+	pushOpts := push.Options{
+		Timeout:        pushTimeout,
+		MaxRetries:     *pushRetries,
+		InitialBackoff: time.Second,
+		MaxBackoff:     pollInterval / 2,
+	}
+
+	if *pushgatewayURL != "" {
+		pg := push.NewPushgateway(*pushgatewayURL, *pushJob, hostname, pushRegistry, pushTimeout)
+		runner := push.NewRunner(pg, pushOpts)
+		if *once {
+			pushes = append(pushes, runner.Push)
+		} else {
+			goRun(func() { runner.Run(ctx) })
+			opts = append(opts, collector.WithPollHook(runner.Trigger))
+
+			// remove our group on shutdown, so the Pushgateway doesn't keep serving stale metrics
+			defer func() {
+				if err := pg.Delete(); err != nil {
+					log.Error().Err(err).Msg("failed to delete metrics from pushgateway")
+				}
+			}()
+		}
+	}
+
+	if *remoteWriteURL != "" {
+		rw := push.NewRemoteWrite(*remoteWriteURL, map[string]string{"job": *pushJob, "instance": hostname}, pushRegistry)
+		runner := push.NewRunner(rw, pushOpts)
+		if *once {
+			pushes = append(pushes, runner.Push)
+		} else {
+			goRun(func() { runner.Run(ctx) })
+			opts = append(opts, collector.WithPollHook(runner.Trigger))
+		}
+	}
+
+	c, err := collector.New(s, pollInterval, opts...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create collector")
 	}
+	pushRegistry.MustRegister(c)
 
-	go func() {
-		err := c.Run()
+	if *once {
+		err := runOnce(ctx, c, pushRegistry, outputFormat, *outputFile, pushes)
+		stop()
+		wg.Wait()
 		if err != nil {
-			log.Fatal().Err(err).Msg("failed to run collector")
+			log.Fatal().Err(err).Msg("-once run failed")
 		}
-	}()
+		return
+	}
+
+	goRun(func() {
+		if err := c.Run(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to run collector")
+		}
+	})
 
 	if err := prometheus.Register(c); err != nil {
 		log.Fatal().Err(err).Msg("failed to register collector")
 	}
-	http.Handle("/metrics", promhttp.Handler())
+	metricsHandler := promhttp.Handler()
+	if scrapeMaxAge > 0 {
+		metricsHandler = web.FreshMetricsHandler(metricsHandler, c, scrapeMaxAge, scrapeTimeout)
+	}
+	http.Handle("/metrics", metricsHandler)
+	http.Handle("/influx", web.InfluxHandler(c))
+	http.Handle("/api/v1/devices", web.DevicesHandler(c))
+	http.Handle("/api/v1/devices/", web.DevicesHandler(c))
+	http.Handle("/debug/smartctl/", web.RawOutputHandler(s, *debugRedact))
+	http.Handle("/-/healthy", web.HealthyHandler())
+	http.Handle("/-/ready", web.ReadyHandler(s, c))
+	http.Handle("/", web.StatusHandler(c))
+
+	server := &http.Server{
+		Addr: *addr,
+		// cancel long-lived requests such as event streams on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
 
-	if err := http.ListenAndServe(*addr, nil); err != nil {
+	select {
+	case err := <-serverErr:
 		log.Fatal().Err(err).Msg("failed to start http server")
+	case <-ctx.Done():
+	}
+	stop()
+	log.Info().Msg("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("failed to shut down http server")
+	}
+	// wait for any in-flight poll, push and compaction before flushing state
+	wg.Wait()
+}
+
+func parseHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
 	}
+	return headers
 }
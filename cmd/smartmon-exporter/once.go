@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/collector"
+	"github.com/milesbxf/smartmon-exporter/pkg/output"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runOnce polls all devices once, writes the result to path, or stdout if path is empty, and then runs pushes. Files
+// are replaced atomically, so textfile collectors never read a partial file. The output is written and pushed even if
+// some devices fail to poll, but the error is still returned, so the failure shows in the exit status.
+func runOnce(ctx context.Context, c collector.Collector, gatherer prometheus.Gatherer, format output.Format, path string, pushes []func(ctx context.Context) error) error {
+	pollErr := c.Poll(ctx)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := writeOnce(c, gatherer, format, path); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	var pushErr error
+	for _, push := range pushes {
+		if err := push(ctx); err != nil && pushErr == nil {
+			pushErr = fmt.Errorf("failed to push metrics: %w", err)
+		}
+	}
+	if pollErr != nil {
+		return fmt.Errorf("failed to poll devices: %w", pollErr)
+	}
+	return pushErr
+}
+
+func writeOnce(c collector.Collector, gatherer prometheus.Gatherer, format output.Format, path string) error {
+	write := func(w io.Writer) error {
+		return output.Write(w, format, gatherer, c.Snapshot(), time.Now())
+	}
+	if path == "" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"github.com/milesbxf/smartmon-exporter/pkg/rules"
+	"github.com/rs/zerolog/log"
+	"os"
+	"time"
+)
+
+func runRules(args []string) {
+	cfg := rules.DefaultConfig()
+	fs := flag.NewFlagSet("rules", flag.ExitOnError)
+	fs.StringVar(&cfg.Job, "job", cfg.Job, "The Prometheus job label of the exporter's scrape targets.")
+	forStr := fs.String("for", cfg.For.String(), "How long a condition must hold before alerts fire.")
+	fs.Float64Var(&cfg.TemperatureCelsius, "temperature-threshold", cfg.TemperatureCelsius, "Temperature in Celsius above which to alert.")
+	fs.Float64Var(&cfg.LifeUsedPercent, "life-used-threshold", cfg.LifeUsedPercent, "Percentage of SSD endurance used above which to alert.")
+	fs.Float64Var(&cfg.LifeRemainingDays, "life-remaining-threshold", cfg.LifeRemainingDays, "Estimated days of SSD endurance remaining below which to alert.")
+	fs.Float64Var(&cfg.FailureRiskScore, "risk-threshold", cfg.FailureRiskScore, "Failure risk score above which to alert.")
+	windowStr := fs.String("reallocation-window", cfg.ReallocationsInWindow.String(), "Window in which to alert on reallocated sector changes.")
+	_ = fs.Parse(args)
+
+	var err error
+	if cfg.For, err = time.ParseDuration(*forStr); err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse for duration %s", *forStr)
+	}
+	if cfg.ReallocationsInWindow, err = time.ParseDuration(*windowStr); err != nil {
+		log.Fatal().Err(err).Msgf("Could not parse reallocation window %s", *windowStr)
+	}
+
+	if err := rules.Write(os.Stdout, rules.Generate(cfg)); err != nil {
+		log.Fatal().Err(err).Msg("failed to write rules")
+	}
+}
@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoffDelay returns how long to wait before polling a device again after n consecutive failures: the poll
+// interval, doubled for each failure after the first and capped at max, plus up to 10% jitter so that failing
+// devices aren't retried in lockstep. Zero means the device should be polled on the normal schedule.
+func backoffDelay(n int, interval, max time.Duration) time.Duration {
+	if n <= 1 || max <= interval {
+		return 0
+	}
+	d := interval
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/10+1))
+}
+
+// due reports whether a device should be polled at now. Polls happen on ticks of the poll interval, so a device
+// is due if its next poll falls before the middle of the following interval.
+func (d *device) due(now time.Time, interval time.Duration) bool {
+	return d.nextPoll.IsZero() || now.Add(interval/2).After(d.nextPoll)
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		interval time.Duration
+		max      time.Duration
+		want     time.Duration
+	}{
+		{"no failures", 0, time.Minute, time.Hour, 0},
+		{"first failure", 1, time.Minute, time.Hour, 0},
+		{"max equal to interval", 5, time.Minute, time.Minute, 0},
+		{"max below interval", 5, time.Minute, 30 * time.Second, 0},
+		{"second failure", 2, time.Minute, time.Hour, 2 * time.Minute},
+		{"third failure", 3, time.Minute, time.Hour, 4 * time.Minute},
+		{"sixth failure", 6, time.Minute, time.Hour, 32 * time.Minute},
+		{"capped", 7, time.Minute, time.Hour, time.Hour},
+		{"many failures", 1000, time.Minute, time.Hour, time.Hour},
+		{"cap not a power of two", 3, time.Minute, 3 * time.Minute, 3 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the jitter is random, so check the bounds repeatedly
+			for i := 0; i < 100; i++ {
+				got := backoffDelay(tt.n, tt.interval, tt.max)
+				if got < tt.want || got > tt.want+tt.want/10 {
+					t.Fatalf("backoffDelay(%d, %s, %s) = %s, want %s plus up to 10%% jitter",
+						tt.n, tt.interval, tt.max, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffDelayJitters(t *testing.T) {
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		seen[backoffDelay(3, time.Minute, time.Hour)] = true
+	}
+	if len(seen) < 2 {
+		t.Error("backoff delays don't vary, so failing devices would be retried in lockstep")
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		nextPoll time.Time
+		want     bool
+	}{
+		{"not backing off", time.Time{}, true},
+		{"next poll passed", now.Add(-time.Second), true},
+		{"next poll now", now, true},
+		{"next poll before the middle of the next interval", now.Add(29 * time.Second), true},
+		{"next poll at the middle of the next interval", now.Add(30 * time.Second), false},
+		{"next poll after the next interval", now.Add(2 * time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &device{nextPoll: tt.nextPoll}
+			if got := d.due(now, time.Minute); got != tt.want {
+				t.Errorf("due() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
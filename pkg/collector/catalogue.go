@@ -0,0 +1,25 @@
+package collector
+
+// Names of the metrics which generated alerting rules and dashboards are built from. Referencing these rather than
+// string literals keeps the generated artifacts in step with what the collector exports.
+const (
+	MetricDeviceInfo                 = "smart_device_info"
+	MetricSmartStatusPassed          = "smart_device_smart_status_passed"
+	MetricTemperature                = "smart_device_temperature"
+	MetricPowerOnTimeSeconds         = "smart_device_power_on_time_seconds"
+	MetricOpenFailure                = "smart_device_open_failure"
+	MetricCommandFailure             = "smart_device_command_failure"
+	MetricDiskFailing                = "smart_device_disk_failing"
+	MetricPrefailuresAboveThreshold  = "smart_device_prefailures_above_threshold"
+	MetricWrittenBytes               = "smart_device_written_bytes"
+	MetricLifeUsedPercent            = "smart_device_life_used_percent"
+	MetricEstimatedLifeRemainingDays = "smart_device_estimated_life_remaining_days"
+	MetricFailureRiskScore           = "smart_device_failure_risk_score"
+	MetricRiskFactors                = "smart_device_risk_factors"
+	MetricAttributeChangesTotal      = "smart_attribute_changes_total"
+	MetricNvmeErrorLogEntriesTotal   = "smart_nvme_error_log_entries_total"
+	MetricConsecutiveFailures        = "smart_device_consecutive_poll_failures"
+	MetricBackoffSeconds             = "smart_device_poll_backoff_seconds"
+	MetricDataAgeSeconds             = "smart_device_data_age_seconds"
+	MetricDeviceUp                   = "smart_device_up"
+)
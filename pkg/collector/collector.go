@@ -1,93 +1,613 @@
 package collector
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/events"
+	"github.com/milesbxf/smartmon-exporter/pkg/risk"
 	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+	"strings"
 	"sync"
 	"time"
 )
 
 type Collector interface {
-	Run() error
+	Run(ctx context.Context) error
+	Poll(ctx context.Context) error
+	Snapshot() []smartctl.InfoAllOutput
+	Devices() []DeviceStatus
+	Ready() error
+	Refresh(ctx context.Context, maxAge time.Duration) error
 }
 
 type collector struct {
 	smart        smartctl.SmartCtl
-	devices      []string
-	metrics      []*Metrics
+	devices      []*device
 	pollInterval time.Duration
+	farmLog      bool
+	history      History
+	detector     *events.Detector
+	events       EventPublisher
+	changes      *prometheus.CounterVec
+	failures     *prometheus.GaugeVec
+	backoff      *prometheus.GaugeVec
+	maxBackoff   time.Duration
+	schedule     Schedule
+	dataAge      *prometheus.Desc
+	up           *prometheus.Desc
+	openFailure  *prometheus.Desc
+	cmdFailure   *prometheus.Desc
+	staleTTL     time.Duration
+	removalTTL   time.Duration
+	lastScan     time.Time
+	refreshes    singleflight.Group
+	risk         *risk.Scorer
+	pollHooks    []func()
 	mu           sync.RWMutex
+
+	// readiness is tracked separately from mu so that probes don't block on a poll in progress
+	readyMu          sync.Mutex
+	readyMissedPolls int
+	polled           bool
+	lastSuccess      time.Time
+}
+
+// EventPublisher receives the attribute changes detected between consecutive polls of a device, and the initial
+// health state of each device as events marked Initial.
+type EventPublisher interface {
+	Publish(events ...events.Event)
+}
+
+// History receives a snapshot of each device's information after every successful poll.
+type History interface {
+	Put(info smartctl.InfoAllOutput, t time.Time) error
+}
+
+type Option func(*collector)
+
+// WithRiskScorer replaces the default failure risk scoring configuration.
+func WithRiskScorer(s *risk.Scorer) Option {
+	return func(c *collector) {
+		c.risk = s
+	}
+}
+
+// WithPollHook registers a function to be called after every poll, once the new data is visible to Collect.
+func WithPollHook(f func()) Option {
+	return func(c *collector) {
+		c.pollHooks = append(c.pollHooks, f)
+	}
+}
+
+func WithEvents(p EventPublisher) Option {
+	return func(c *collector) {
+		c.events = p
+	}
+}
+
+func WithHistory(h History) Option {
+	return func(c *collector) {
+		c.history = h
+	}
+}
+
+// WithReadyMissedPolls makes the collector unready once n poll intervals have passed without a successful poll.
+// Zero disables the check.
+func WithReadyMissedPolls(n int) Option {
+	return func(c *collector) {
+		c.readyMissedPolls = n
+	}
+}
+
+// WithMaxBackoff enables exponential backoff, up to max, for devices which fail to be polled repeatedly.
+func WithMaxBackoff(max time.Duration) Option {
+	return func(c *collector) {
+		c.maxBackoff = max
+	}
+}
+
+// WithSchedule polls groups of device information at the intervals configured by s, rather than every poll.
+func WithSchedule(s Schedule) Option {
+	return func(c *collector) {
+		c.schedule = s
+	}
+}
+
+// WithStaleness stops exporting a device's metrics once it hasn't been polled successfully for staleTTL, and
+// removes it entirely after removalTTL if it's no longer found by a rescan. Zero disables either.
+func WithStaleness(staleTTL, removalTTL time.Duration) Option {
+	return func(c *collector) {
+		c.staleTTL = staleTTL
+		c.removalTTL = removalTTL
+	}
+}
+
+// WithFarmLog enables collection of the Seagate FARM log for drives which support it.
+func WithFarmLog(enabled bool) Option {
+	return func(c *collector) {
+		c.farmLog = enabled
+	}
 }
 
 func (c *collector) Describe(descs chan<- *prometheus.Desc) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	for _, m := range c.metrics {
-		m.Describe(descs)
+	for _, d := range c.devices {
+		d.metrics.Describe(descs)
 	}
+	c.changes.Describe(descs)
+	c.failures.Describe(descs)
+	c.backoff.Describe(descs)
+	descs <- c.dataAge
+	descs <- c.up
+	descs <- c.openFailure
+	descs <- c.cmdFailure
 }
 
 func (c *collector) Collect(metrics chan<- prometheus.Metric) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	for _, m := range c.metrics {
-		m.Collect(metrics)
+	now := time.Now()
+	for _, d := range c.devices {
+		up := 0.0
+		if d.up(now, c.staleTTL) {
+			up = 1
+		}
+		metrics <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up, d.name)
+		if !d.lastPoll.IsZero() {
+			// these report why the device is down, so are exported even once its data is stale
+			metrics <- prometheus.MustNewConstMetric(c.openFailure, prometheus.GaugeValue,
+				boolGauge(d.exitStatus.DeviceOpenFailed), d.name)
+			metrics <- prometheus.MustNewConstMetric(c.cmdFailure, prometheus.GaugeValue,
+				boolGauge(d.exitStatus.CommandFailed), d.name)
+		}
+		if !d.stale(now, c.staleTTL) {
+			d.metrics.Collect(metrics)
+		}
+	}
+	c.changes.Collect(metrics)
+	c.failures.Collect(metrics)
+	c.backoff.Collect(metrics)
+	for _, d := range c.devices {
+		if !d.lastSuccess.IsZero() && !d.stale(now, c.staleTTL) {
+			metrics <- prometheus.MustNewConstMetric(c.dataAge, prometheus.GaugeValue, now.Sub(d.lastSuccess).Seconds(), d.name)
+		}
 	}
 }
 
-func (c *collector) Run() error {
-	if err := c.poll(); err != nil {
-		log.Error().Err(err).Msg("failed to do initial poll")
+// Run polls all devices every poll interval until ctx is cancelled. A poll in progress when ctx is cancelled
+// finishes the device it is polling, so smartctl is never interrupted mid-command, and Run returns once it has.
+func (c *collector) Run(ctx context.Context) error {
+	if err := c.Poll(ctx); err != nil {
+		log.Debug().Err(err).Msg("initial poll failed for some devices")
 	}
 
 	t := time.NewTicker(c.pollInterval)
-	for range t.C {
-		if err := c.poll(); err != nil {
-			log.Error().Err(err).Msg("failed to poll")
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if err := c.Poll(ctx); err != nil {
+				log.Debug().Err(err).Msg("poll failed for some devices")
+			}
 		}
 	}
-	return nil
 }
 
-func (c *collector) poll() error {
+// Poll polls all devices once and runs the poll hooks. Devices not yet polled when ctx is cancelled are skipped.
+func (c *collector) Poll(ctx context.Context) error {
+	err := c.poll(ctx)
+	if ctx.Err() != nil {
+		return err
+	}
+	c.runPollHooks()
+	return err
+}
+
+// Snapshot returns the latest information polled from each device.
+func (c *collector) Snapshot() []smartctl.InfoAllOutput {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	infos := []smartctl.InfoAllOutput{}
+	now := time.Now()
+	for _, d := range c.devices {
+		if d.info != nil && !d.stale(now, c.staleTTL) {
+			infos = append(infos, *d.info)
+		}
+	}
+	return infos
+}
+
+func (c *collector) runPollHooks() {
+	for _, f := range c.pollHooks {
+		f()
+	}
+}
+
+func (c *collector) poll(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	for i, d := range c.devices {
-		info, err := c.smart.InfoAll(d)
-		if err != nil {
-			return err
+	var firstErr error
+	// a poll succeeds if any device is polled successfully, or is healthy but has nothing due
+	succeeded := len(c.devices) == 0
+	for _, d := range c.devices {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.due(time.Now(), c.pollInterval) {
+			d.logger().Debug().Time("next_poll", d.nextPoll).Msg("skipping device in backoff")
+			continue
 		}
-		log.Info().Str("device", d).Msg("got info")
+		groups := c.dueGroups(d, time.Now())
+		if len(groups) == 0 {
+			succeeded = succeeded || d.pollFailures.consecutive == 0
+			continue
+		}
+		if err := c.pollDeviceGroups(d, groups); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			succeeded = true
+		}
+	}
 
-		for _, m := range c.metrics[i].metrics {
-			if err := m.UpdateFromInfo(*info); err != nil {
-				return err
+	c.collectGarbage(time.Now())
+
+	c.readyMu.Lock()
+	c.polled = true
+	if succeeded {
+		c.lastSuccess = time.Now()
+	}
+	c.readyMu.Unlock()
+	return firstErr
+}
+
+// pollDeviceGroups polls groups from d, backing off from the device if it fails. c.mu must be held.
+func (c *collector) pollDeviceGroups(d *device, groups []smartctl.Group) error {
+	return c.applyQuery(d, c.query(d.name, d.info, groups))
+}
+
+// applyQuery updates d from the result of querying it, backing off from the device if the query failed. c.mu must
+// be held.
+func (c *collector) applyQuery(d *device, r queryResult) error {
+	err := c.updateDevice(d, r)
+	if err != nil {
+		d.backoff = backoffDelay(d.pollFailures.consecutive+1, c.pollInterval, c.maxBackoff)
+		d.nextPoll = d.lastPoll.Add(d.backoff)
+		d.pollFailures.failed(d.logger(), time.Now()).Err(err).Dur("backoff", d.backoff).Msg("failed to poll device")
+	} else {
+		d.pollFailures.succeeded(d.logger(), "device recovered")
+		d.backoff = 0
+		d.nextPoll = time.Time{}
+	}
+	c.failures.WithLabelValues(d.name).Set(float64(d.pollFailures.consecutive))
+	c.backoff.WithLabelValues(d.name).Set(d.backoff.Seconds())
+	return err
+}
+
+// Refresh polls devices whose data is older than maxAge, for the groups due or at least the temperature, unless
+// they are backing off. smartctl runs without holding the collector's lock, so metrics can still be collected.
+// Concurrent refreshes for the same maxAge are coalesced into one, which continues in the background if ctx is
+// cancelled first.
+func (c *collector) Refresh(ctx context.Context, maxAge time.Duration) error {
+	if !c.needsRefresh(maxAge) {
+		return nil
+	}
+	ch := c.refreshes.DoChan(maxAge.String(), func() (interface{}, error) {
+		return nil, c.refresh(maxAge)
+	})
+	select {
+	case res := <-ch:
+		return res.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// needsRefresh reports whether any device which isn't backing off has data older than maxAge.
+func (c *collector) needsRefresh(maxAge time.Duration) bool {
+	return len(c.refreshTargets(maxAge)) > 0
+}
+
+// refreshTarget is a device to refresh, with the state the refresh starts from.
+type refreshTarget struct {
+	d        *device
+	prev     *smartctl.InfoAllOutput
+	lastPoll time.Time
+	age      time.Duration
+	groups   []smartctl.Group
+}
+
+// refreshTargets returns the devices which need refreshing for maxAge.
+func (c *collector) refreshTargets(maxAge time.Duration) []refreshTarget {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	targets := []refreshTarget{}
+	for _, d := range c.devices {
+		if time.Since(d.lastSuccess) <= maxAge || !d.due(time.Now(), c.pollInterval) {
+			continue
+		}
+		groups := c.dueGroups(d, time.Now())
+		if len(groups) == 0 {
+			groups = []smartctl.Group{smartctl.GroupTemperature}
+		}
+		targets = append(targets, refreshTarget{
+			d:        d,
+			prev:     d.info,
+			lastPoll: d.lastPoll,
+			age:      time.Since(d.lastSuccess),
+			groups:   groups,
+		})
+	}
+	return targets
+}
+
+func (c *collector) refresh(maxAge time.Duration) error {
+	var firstErr error
+	for _, t := range c.refreshTargets(maxAge) {
+		log.Debug().Str("device", t.d.name).Dur("age", t.age).Msg("refreshing stale device")
+		r := c.query(t.d.name, t.prev, t.groups)
+
+		c.mu.Lock()
+		// a poll or removal of the device while smartctl ran supersedes the refresh
+		if t.d.lastPoll.Equal(t.lastPoll) && c.hasDevice(t.d) {
+			if err := c.applyQuery(t.d, r); err != nil && firstErr == nil {
+				firstErr = err
 			}
 		}
+		c.mu.Unlock()
+	}
+	return firstErr
+}
+
+func (c *collector) hasDevice(d *device) bool {
+	for _, v := range c.devices {
+		if v == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Ready returns an error until the first poll has completed, or if no device has been polled successfully within
+// the configured number of poll intervals. A single failing device doesn't make the collector unready.
+func (c *collector) Ready() error {
+	c.readyMu.Lock()
+	defer c.readyMu.Unlock()
+	if !c.polled {
+		return errors.New("initial poll has not completed")
+	}
+	if c.readyMissedPolls <= 0 {
+		return nil
+	}
+	if c.lastSuccess.IsZero() {
+		return errors.New("no poll has succeeded")
+	}
+	if since := time.Since(c.lastSuccess); since > time.Duration(c.readyMissedPolls)*c.pollInterval {
+		return fmt.Errorf("no poll has succeeded for %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+// queryResult is the outcome of querying a device with smartctl, which is applied to the device under c.mu.
+type queryResult struct {
+	start  time.Time
+	groups []smartctl.Group
+	info   *smartctl.InfoAllOutput
+	err    error
+	// farmErr is the error reading the FARM log, if farmRead
+	farmRead bool
+	farmErr  error
+}
+
+// query runs smartctl to get groups of information about the device name, last polled as prev. It doesn't touch
+// any device state, so c.mu needn't be held.
+func (c *collector) query(name string, prev *smartctl.InfoAllOutput, groups []smartctl.Group) queryResult {
+	r := queryResult{start: time.Now(), groups: groups}
+	r.info, r.err = c.smart.Query(name, prev, groups...)
+	if r.err == nil {
+		// smartctl outputs JSON even when it fails, so only its exit status shows whether the information is complete
+		r.err = r.info.SmartExitCodeOutput.Err()
+	}
+	if r.err != nil {
+		return r
+	}
+	if c.farmLog && farmLogSupported(*r.info) && containsGroup(groups, smartctl.GroupLogs) {
+		r.farmRead = true
+		farm, err := c.smart.FarmLog(name)
+		if err != nil {
+			r.farmErr = err
+		} else {
+			r.info.SeagateFarmLog = farm.SeagateFarmLog
+		}
+	}
+	return r
+}
+
+// updateDevice updates d's metrics and state from the result of querying it. c.mu must be held.
+func (c *collector) updateDevice(d *device, r queryResult) error {
+	d.lastPoll = r.start
+	if r.info != nil {
+		d.exitStatus = r.info.SmartExitCodeOutput
+	}
+	if r.err != nil {
+		d.lastErr = r.err
+		return r.err
+	}
+	d.logger().Debug().Interface("groups", r.groups).Msg("got info")
+
+	if r.farmRead {
+		if r.farmErr != nil {
+			d.farmFailures.failed(d.logger(), time.Now()).Err(r.farmErr).Msg("failed to get FARM log")
+		} else {
+			d.farmFailures.succeeded(d.logger(), "FARM log recovered")
+		}
+	}
+
+	info := r.info
+	if err := d.metrics.UpdateFromInfo(*info); err != nil {
+		d.lastErr = err
+		return err
+	}
+
+	c.detectChanges(d, info)
+	d.info = info
+	d.lastSuccess = d.lastPoll
+	d.lastErr = nil
+	for _, g := range r.groups {
+		d.polled[g] = d.lastPoll
+	}
+
+	if c.history != nil {
+		if err := c.history.Put(*info, d.lastPoll); err != nil {
+			d.logger().Error().Err(err).Msg("failed to store history")
+		}
 	}
 	return nil
 }
 
-func New(smart smartctl.SmartCtl, pollInterval time.Duration) (*collector, error) {
+func (c *collector) detectChanges(d *device, info *smartctl.InfoAllOutput) {
+	// output without a serial number can't show that a different drive is there, e.g. if the device is failing
+	if d.info != nil && info.SerialNumber != "" && d.info.Identity() != info.Identity() {
+		// a different drive has taken the device's place, so its attributes can't be compared with the last poll
+		d.logger().Info().Str("previous", d.info.Identity()).Str("identity", info.Identity()).Msg("device replaced")
+		d.info = nil
+	}
+	if d.info == nil {
+		if c.events != nil {
+			c.events.Publish(c.detector.Initial(*info, time.Now())...)
+		}
+		return
+	}
+
+	changes := c.detector.Diff(*d.info, *info, time.Now())
+	for _, e := range changes {
+		d.logger().Info().
+			Str("attribute", e.Attribute).
+			Int64("old", e.Old).
+			Int64("new", e.New).
+			Msg("attribute changed")
+		c.changes.WithLabelValues(e.Device, e.Attribute).Inc()
+		d.changedAttributes[e.Attribute] = true
+	}
+	if c.events != nil && len(changes) > 0 {
+		c.events.Publish(changes...)
+	}
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func containsGroup(groups []smartctl.Group, g smartctl.Group) bool {
+	for _, v := range groups {
+		if v == g {
+			return true
+		}
+	}
+	return false
+}
+
+func farmLogSupported(info smartctl.InfoAllOutput) bool {
+	return info.Device.Protocol == "ATA" &&
+		(strings.HasPrefix(info.ModelFamily, "Seagate") || strings.HasPrefix(info.ModelName, "ST"))
+}
+
+func New(smart smartctl.SmartCtl, pollInterval time.Duration, opts ...Option) (*collector, error) {
+	c := &collector{
+		smart:        smart,
+		pollInterval: pollInterval,
+		detector:     events.NewDetector(events.DefaultIgnoredAttributes),
+		changes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricAttributeChangesTotal,
+			Help: "Number of changes observed in device attributes between polls",
+		}, []string{"device", "attribute"}),
+		failures: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: MetricConsecutiveFailures,
+			Help: "Number of consecutive polls of the device which have failed",
+		}, []string{"device"}),
+		dataAge: prometheus.NewDesc(
+			MetricDataAgeSeconds,
+			"Time since the device was last polled successfully, exported until its data is stale",
+			[]string{"device"},
+			nil,
+		),
+		up: prometheus.NewDesc(
+			MetricDeviceUp,
+			"Whether the last poll of the device succeeded and its metrics are current",
+			[]string{"device"},
+			nil,
+		),
+		openFailure: prometheus.NewDesc(
+			MetricOpenFailure,
+			"Whether smartctl failed to open the device on the last poll",
+			[]string{"device"},
+			nil,
+		),
+		cmdFailure: prometheus.NewDesc(
+			MetricCommandFailure,
+			"Whether a SMART command to the device failed on the last poll",
+			[]string{"device"},
+			nil,
+		),
+		backoff: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: MetricBackoffSeconds,
+			Help: "Current delay before the device is polled again after repeated failures, or 0 if it is polled every interval",
+		}, []string{"device"}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.risk == nil {
+		scorer, err := risk.New(risk.DefaultConfig())
+		if err != nil {
+			return nil, err
+		}
+		c.risk = scorer
+	}
+
+	if err := c.schedule.validate(pollInterval); err != nil {
+		return nil, err
+	}
+	if c.staleTTL > 0 && c.staleTTL <= pollInterval {
+		return nil, fmt.Errorf("stale TTL %s must be longer than the poll interval %s", c.staleTTL, pollInterval)
+	}
+
 	scan, err := smart.ScanOpen()
 	if err != nil {
 		return nil, err
 	}
 
-	devices := []string{}
-	metrics := []*Metrics{}
-
+	c.lastScan = time.Now()
 	for _, d := range scan.Devices {
-		log.Info().Str("device", d.Name).Msg("found device")
-		devices = append(devices, d.Name)
-		metrics = append(metrics, NewMetrics())
+		c.addDevice(d.Name, c.lastScan)
 	}
 
-	return &collector{
-		smart:        smart,
-		devices:      devices,
-		metrics:      metrics,
-		pollInterval: pollInterval,
-	}, nil
+	return c, nil
+}
+
+func (c *collector) addDevice(name string, now time.Time) {
+	log.Info().Str("device", name).Msg("found device")
+	m := NewMetrics()
+	m.metrics = append(m.metrics, riskMetrics(c.risk)...)
+	c.devices = append(c.devices, &device{
+		name:              name,
+		metrics:           m,
+		added:             now,
+		polled:            map[smartctl.Group]time.Time{},
+		changedAttributes: map[string]bool{},
+	})
+	c.failures.WithLabelValues(name).Set(0)
+	c.backoff.WithLabelValues(name).Set(0)
 }
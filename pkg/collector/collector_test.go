@@ -0,0 +1,261 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// fakeSmartCtl reports a healthy ATA drive at each of devices, unless it is set to fail to open.
+type fakeSmartCtl struct {
+	mu        sync.Mutex
+	devices   []string
+	failing   map[string]bool
+	serials   map[string]string
+	queries   int
+	forgotten []string
+	// queried, if set, is sent to when the next query starts, which then waits for release to be closed
+	queried chan string
+	release chan struct{}
+}
+
+// blockNextQuery makes the next query block until the returned function is called, returning a channel which
+// receives the device queried once it starts.
+func (f *fakeSmartCtl) blockNextQuery() (<-chan string, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queried, release := make(chan string, 1), make(chan struct{})
+	f.queried, f.release = queried, release
+	return queried, func() { close(release) }
+}
+
+func newFakeSmartCtl(devices ...string) *fakeSmartCtl {
+	return &fakeSmartCtl{devices: devices, failing: map[string]bool{}, serials: map[string]string{}}
+}
+
+func (f *fakeSmartCtl) setFailing(device string, failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing[device] = failing
+}
+
+// setSerial replaces the drive reported for device with another with serial.
+func (f *fakeSmartCtl) setSerial(device, serial string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.serials[device] = serial
+}
+
+func (f *fakeSmartCtl) setDevices(devices ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices = devices
+}
+
+func (f *fakeSmartCtl) ScanOpen() (*smartctl.ScanOpenOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &smartctl.ScanOpenOutput{}
+	for _, d := range f.devices {
+		out.Devices = append(out.Devices, smartctl.Device{Name: d, Protocol: "ATA"})
+	}
+	return out, nil
+}
+
+func (f *fakeSmartCtl) InfoAll(device string) (*smartctl.InfoAllOutput, error) {
+	return f.Query(device, nil)
+}
+
+func (f *fakeSmartCtl) Query(device string, prev *smartctl.InfoAllOutput, groups ...smartctl.Group) (*smartctl.InfoAllOutput, error) {
+	f.mu.Lock()
+	queried, release := f.queried, f.release
+	f.queried, f.release = nil, nil
+	f.mu.Unlock()
+	if queried != nil {
+		queried <- device
+		<-release
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries++
+	if f.failing[device] {
+		// like smartctl, output the little known about the device and report the failure in the exit status
+		return &smartctl.InfoAllOutput{
+			Device:              smartctl.Device{Name: device},
+			SmartExitCodeOutput: smartctl.SmartOutputFromExitCode(0x2),
+		}, nil
+	}
+	serial, ok := f.serials[device]
+	if !ok {
+		serial = "SN" + device
+	}
+	info := &smartctl.InfoAllOutput{
+		Device:       smartctl.Device{Name: device, Protocol: "ATA"},
+		SerialNumber: serial,
+	}
+	info.SmartStatus.Passed = true
+	info.Temperature.Current = 30
+	return info, nil
+}
+
+func (f *fakeSmartCtl) FarmLog(device string) (*smartctl.FarmLogOutput, error) {
+	return nil, errors.New("no FARM log")
+}
+
+func (f *fakeSmartCtl) Forget(device string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.forgotten = append(f.forgotten, device)
+}
+
+func (f *fakeSmartCtl) Version() (*smartctl.VersionOutput, error) {
+	return &smartctl.VersionOutput{SmartCtlInfo: smartctl.SmartCtlInfo{SmartCtlVersion: []int{7, 3}}}, nil
+}
+
+func newTestCollector(t *testing.T, smart smartctl.SmartCtl, opts ...Option) *collector {
+	t.Helper()
+	c, err := New(smart, time.Minute, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// pollAll polls c with every group of every device due, as if the schedule's longest interval had passed.
+func pollAll(c *collector) error {
+	c.mu.Lock()
+	for _, d := range c.devices {
+		d.polled = map[smartctl.Group]time.Time{}
+	}
+	c.mu.Unlock()
+	return c.Poll(context.Background())
+}
+
+func TestRefreshDoesntBlockCollect(t *testing.T) {
+	smart := newFakeSmartCtl("/dev/sda")
+	c := newTestCollector(t, smart)
+	if err := c.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	queried, release := smart.blockNextQuery()
+	refreshed := make(chan error)
+	go func() { refreshed <- c.Refresh(context.Background(), 0) }()
+	<-queried
+
+	collected := make(chan int)
+	go func() { collected <- testutil.CollectAndCount(c) }()
+	select {
+	case <-collected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collecting metrics blocked on a refresh in progress")
+	}
+
+	release()
+	if err := <-refreshed; err != nil {
+		t.Fatal(err)
+	}
+	if smart.queries != 2 {
+		t.Errorf("got %d queries, want 2", smart.queries)
+	}
+}
+
+func TestRefreshSupersededByPoll(t *testing.T) {
+	smart := newFakeSmartCtl("/dev/sda")
+	c := newTestCollector(t, smart)
+	if err := c.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	queried, release := smart.blockNextQuery()
+	refreshed := make(chan error)
+	go func() { refreshed <- c.Refresh(context.Background(), 0) }()
+	<-queried
+
+	// the device fails a poll while the refresh is in progress, which the refresh's result mustn't overwrite
+	smart.setFailing("/dev/sda", true)
+	c.mu.Lock()
+	err := c.pollDeviceGroups(c.devices[0], smartctl.Groups)
+	c.mu.Unlock()
+	if err == nil {
+		t.Fatal("expected the poll to fail")
+	}
+	smart.setFailing("/dev/sda", false)
+
+	release()
+	if err := <-refreshed; err != nil {
+		t.Fatal(err)
+	}
+	if c.devices[0].lastErr == nil {
+		t.Error("refresh started before a failed poll overwrote its result")
+	}
+}
+
+func TestRefreshFreshData(t *testing.T) {
+	smart := newFakeSmartCtl("/dev/sda")
+	c := newTestCollector(t, smart)
+	if err := c.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Refresh(context.Background(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if smart.queries != 1 {
+		t.Errorf("got %d queries, want data younger than maxAge not to be refreshed", smart.queries)
+	}
+}
+
+func TestExitStatusFailures(t *testing.T) {
+	smart := newFakeSmartCtl("/dev/sda")
+	c := newTestCollector(t, smart, WithMaxBackoff(time.Hour))
+	if err := pollAll(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// smartctl outputs JSON when it can't open the device, but the exit status makes the poll fail
+	smart.setFailing("/dev/sda", true)
+	for i := 1; i <= 2; i++ {
+		c.devices[0].nextPoll = time.Time{}
+		err := pollAll(c)
+		var exitErr *smartctl.ExitError
+		if !errors.As(err, &exitErr) || !exitErr.DeviceOpenFailed {
+			t.Fatalf("got error %v, want a device open failure", err)
+		}
+		values := gather(t, c)
+		if got := values[MetricConsecutiveFailures]["/dev/sda"]; got != float64(i) {
+			t.Errorf("got %v consecutive failures, want %d", got, i)
+		}
+		if values[MetricOpenFailure]["/dev/sda"] != 1 || values[MetricDeviceUp]["/dev/sda"] != 0 {
+			t.Errorf("device isn't reported as failing to open: %v", values)
+		}
+	}
+	if c.devices[0].backoff == 0 {
+		t.Error("not backing off from a device which keeps failing to open")
+	}
+	if c.devices[0].info.SerialNumber == "" {
+		t.Error("the failed polls' output replaced the device's information")
+	}
+
+	smart.setFailing("/dev/sda", false)
+	c.devices[0].nextPoll = time.Time{}
+	if err := pollAll(c); err != nil {
+		t.Fatal(err)
+	}
+	values := gather(t, c)
+	if values[MetricOpenFailure]["/dev/sda"] != 0 || values[MetricConsecutiveFailures]["/dev/sda"] != 0 {
+		t.Errorf("recovered device is still reported as failing: %v", values)
+	}
+}
@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+type device struct {
+	name        string
+	metrics     *Metrics
+	info        *smartctl.InfoAllOutput
+	lastPoll    time.Time
+	lastSuccess time.Time
+	lastErr     error
+	// exitStatus is smartctl's exit status on the last poll which ran it, reporting command failures even when the
+	// poll failed
+	exitStatus smartctl.SmartExitCodeOutput
+
+	pollFailures failureLog
+	farmFailures failureLog
+	// backoff is the current delay before retrying a failing device, and nextPoll when it is next due
+	backoff  time.Duration
+	nextPoll time.Time
+	// polled is when each group of information was last polled successfully
+	polled map[smartctl.Group]time.Time
+	added  time.Time
+	// changedAttributes are the attributes with change counters, to delete if the device is removed
+	changedAttributes map[string]bool
+}
+
+// logger returns a logger with the device, and its serial number once known, attached.
+func (d *device) logger() *zerolog.Logger {
+	ctx := log.With().Str("device", d.name)
+	if d.info != nil && d.info.SerialNumber != "" {
+		ctx = ctx.Str("serial", d.info.SerialNumber)
+	}
+	logger := ctx.Logger()
+	return &logger
+}
+
+type Health string
+
+const (
+	HealthUnknown Health = "unknown"
+	HealthOK      Health = "ok"
+	HealthWarning Health = "warning"
+	HealthFailing Health = "failing"
+)
+
+// DeviceStatus is the latest state of a device, as served by the inventory API.
+type DeviceStatus struct {
+	Device              string                  `json:"device"`
+	Identity            string                  `json:"identity,omitempty"`
+	Health              Health                  `json:"health"`
+	RiskScore           float64                 `json:"risk_score"`
+	LastPoll            time.Time               `json:"last_poll"`
+	LastSuccess         time.Time               `json:"last_success"`
+	LastError           string                  `json:"last_error,omitempty"`
+	Up                  bool                    `json:"up"`
+	ConsecutiveFailures int                     `json:"consecutive_failures"`
+	BackoffSeconds      float64                 `json:"backoff_seconds"`
+	Info                *smartctl.InfoAllOutput `json:"info,omitempty"`
+}
+
+func deriveHealth(info *smartctl.InfoAllOutput, riskScore float64) Health {
+	switch {
+	case info == nil:
+		return HealthUnknown
+	case !info.SmartStatus.Passed || info.SmartExitCodeOutput.DiskFailing:
+		return HealthFailing
+	case info.SmartExitCodeOutput.PrefailAboveThreshold,
+		info.SmartExitCodeOutput.PrefailAboveThresholdInPast,
+		info.SmartExitCodeOutput.RecentSelfTestErrors,
+		riskScore > 0:
+		return HealthWarning
+	}
+	return HealthOK
+}
+
+// Devices returns the status of every device.
+func (c *collector) Devices() []DeviceStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	statuses := []DeviceStatus{}
+	for _, d := range c.devices {
+		s := DeviceStatus{
+			Device:              d.name,
+			LastPoll:            d.lastPoll,
+			LastSuccess:         d.lastSuccess,
+			Up:                  d.up(time.Now(), c.staleTTL),
+			ConsecutiveFailures: d.pollFailures.consecutive,
+			BackoffSeconds:      d.backoff.Seconds(),
+		}
+		if d.lastErr != nil {
+			s.LastError = d.lastErr.Error()
+		}
+		if d.info != nil {
+			info := *d.info
+			s.Identity = info.Identity()
+			s.RiskScore = c.risk.Evaluate(info).Score
+			s.Info = &info
+		}
+		s.Health = deriveHealth(s.Info, s.RiskScore)
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
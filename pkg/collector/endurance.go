@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// nvmeDataUnitBytes is the size of an NVMe data unit: 1000 units of 512 bytes.
+const nvmeDataUnitBytes = 512000
+
+// wearAttributes are vendor-specific ATA attributes whose normalized value counts down from 100 as the media wears.
+var wearAttributes = []string{
+	"Wear_Leveling_Count",
+	"Media_Wearout_Indicator",
+	"Percent_Lifetime_Remain",
+}
+
+func findAttribute(info smartctl.InfoAllOutput, name string) (smartctl.AtaSmartAttributesTable, bool) {
+	for _, e := range info.AtaSmartAttributes.Table {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return smartctl.AtaSmartAttributesTable{}, false
+}
+
+func bytesWritten(info smartctl.InfoAllOutput) (float64, bool) {
+	if info.Device.Protocol == "NVMe" {
+		return float64(info.NvmeSmartHealthInformationLog.DataUnitsWritten) * nvmeDataUnitBytes, true
+	}
+	if e, ok := findAttribute(info, "Total_LBAs_Written"); ok && info.LogicalBlockSize > 0 {
+		return float64(e.Raw.Value) * float64(info.LogicalBlockSize), true
+	}
+	return 0, false
+}
+
+func percentageLifeUsed(info smartctl.InfoAllOutput) (float64, bool) {
+	if info.Device.Protocol == "NVMe" {
+		return float64(info.NvmeSmartHealthInformationLog.PercentageUsed), true
+	}
+	for _, p := range info.AtaDeviceStatistics.Pages {
+		for _, e := range p.Table {
+			if e.Name == "Percentage Used Endurance Indicator" && e.Flags.Valid {
+				return float64(e.Value), true
+			}
+		}
+	}
+	for _, name := range wearAttributes {
+		if e, ok := findAttribute(info, name); ok {
+			return float64(100 - e.Value), true
+		}
+	}
+	return 0, false
+}
+
+// enduranceRemainingMetric estimates the days remaining until the device reaches its rated endurance, from the
+// write rate observed since the device was first polled and the bytes written per percent of life used so far.
+type enduranceRemainingMetric struct {
+	desc         *prometheus.Desc
+	device       string
+	firstWritten float64
+	firstTime    time.Time
+	lastWritten  float64
+	lastTime     time.Time
+	lastUsed     float64
+	observed     bool
+}
+
+func newEnduranceRemainingMetric() *enduranceRemainingMetric {
+	return &enduranceRemainingMetric{
+		desc: prometheus.NewDesc(
+			MetricEstimatedLifeRemainingDays,
+			"Estimated days until the device reaches its rated endurance at the observed write rate",
+			[]string{"device"},
+			nil,
+		),
+	}
+}
+
+func (m *enduranceRemainingMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *enduranceRemainingMetric) Update(metrics chan<- prometheus.Metric) error {
+	if !m.observed || m.lastUsed <= 0 || !m.lastTime.After(m.firstTime) {
+		return nil
+	}
+	rate := (m.lastWritten - m.firstWritten) / m.lastTime.Sub(m.firstTime).Hours() * 24
+	if rate <= 0 {
+		return nil
+	}
+	remaining := m.lastWritten*100/m.lastUsed - m.lastWritten
+	if remaining < 0 {
+		remaining = 0
+	}
+	metrics <- prometheus.MustNewConstMetric(
+		m.desc,
+		prometheus.GaugeValue,
+		remaining/rate,
+		m.device,
+	)
+	return nil
+}
+
+func (m *enduranceRemainingMetric) UpdateFromInfo(info smartctl.InfoAllOutput) error {
+	written, ok := bytesWritten(info)
+	if !ok {
+		return nil
+	}
+	used, ok := percentageLifeUsed(info)
+	if !ok {
+		return nil
+	}
+
+	t := time.Now()
+	if info.LocalTime.TimeT != 0 {
+		t = time.Unix(int64(info.LocalTime.TimeT), 0)
+	}
+
+	// restart the observation window if the counter went backwards, e.g. the device was replaced
+	if !m.observed || written < m.lastWritten {
+		m.firstWritten = written
+		m.firstTime = t
+	}
+	m.device = info.Device.Name
+	m.lastWritten = written
+	m.lastTime = t
+	m.lastUsed = used
+	m.observed = true
+	return nil
+}
@@ -0,0 +1,36 @@
+package collector
+
+import (
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// failureLogInterval is the minimum interval between warnings about an operation which keeps failing.
+const failureLogInterval = 15 * time.Minute
+
+// failureLog rate limits logging of repeated failures: the first failure is a warning, after which failures are
+// logged at debug level except for one warning every failureLogInterval.
+type failureLog struct {
+	consecutive int
+	lastWarned  time.Time
+}
+
+// failed records a failure and returns a log event at the appropriate level.
+func (f *failureLog) failed(logger *zerolog.Logger, now time.Time) *zerolog.Event {
+	f.consecutive++
+	e := logger.Debug()
+	if f.consecutive == 1 || now.Sub(f.lastWarned) >= failureLogInterval {
+		f.lastWarned = now
+		e = logger.Warn()
+	}
+	return e.Int("consecutive_failures", f.consecutive)
+}
+
+// succeeded records a success, logging that the operation has recovered if it was failing.
+func (f *failureLog) succeeded(logger *zerolog.Logger, msg string) {
+	if f.consecutive > 0 {
+		logger.Info().Int("consecutive_failures", f.consecutive).Msg(msg)
+	}
+	f.consecutive = 0
+	f.lastWarned = time.Time{}
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
+	"strconv"
+	"strings"
 )
 
 type PerDeviceInfoMetric interface {
@@ -23,11 +25,11 @@ func (m *Metrics) Describe(descs chan<- *prometheus.Desc) {
 }
 
 func (m Metrics) Collect(metrics chan<- prometheus.Metric) {
-	log.Info().Msg("collecting all metrics")
+	log.Debug().Msg("collecting all metrics")
 	for _, m := range m.metrics {
 		_ = m.Update(metrics)
 	}
-	log.Info().
+	log.Debug().
 		Int("num_metrics", len(m.metrics)).
 		Msg("collected all metrics")
 }
@@ -45,7 +47,7 @@ func NewMetrics() *Metrics {
 		metrics: []PerDeviceInfoMetric{
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_info",
+					MetricDeviceInfo,
 					"Information about the device",
 					[]string{"device", "model_family", "model_name", "serial_number", "firmware_version"},
 					nil,
@@ -151,7 +153,7 @@ func NewMetrics() *Metrics {
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_smart_status_passed",
+					MetricSmartStatusPassed,
 					"Whether the SMART status is a pass",
 					[]string{"device"},
 					nil,
@@ -172,7 +174,7 @@ func NewMetrics() *Metrics {
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_power_on_time_seconds",
+					MetricPowerOnTimeSeconds,
 					"Power on time of the device",
 					[]string{"device"},
 					nil,
@@ -206,7 +208,7 @@ func NewMetrics() *Metrics {
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_temperature",
+					MetricTemperature,
 					"Current temperature of the device",
 					[]string{"device"},
 					nil,
@@ -315,14 +317,14 @@ func NewMetrics() *Metrics {
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_open_failure",
-					"Whether the device failed to open",
+					MetricDiskFailing,
+					"Whether SMART has detected a disk failure for this device",
 					[]string{"device"},
 					nil,
 				),
 				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
 					v := 0.
-					if output.SmartExitCodeOutput.DeviceOpenFailed {
+					if output.SmartExitCodeOutput.DiskFailing {
 						v = 1.
 					}
 					metrics <- prometheus.MustNewConstMetric(
@@ -337,14 +339,14 @@ func NewMetrics() *Metrics {
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_command_failure",
-					"Whether a SMART command failed",
+					MetricPrefailuresAboveThreshold,
+					"Whether SMART has detected prefailure signals currently above threshold",
 					[]string{"device"},
 					nil,
 				),
 				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
 					v := 0.
-					if output.SmartExitCodeOutput.CommandFailed {
+					if output.SmartExitCodeOutput.PrefailAboveThreshold {
 						v = 1.
 					}
 					metrics <- prometheus.MustNewConstMetric(
@@ -359,14 +361,14 @@ func NewMetrics() *Metrics {
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_disk_failing",
-					"Whether SMART has detected a disk failure for this device",
+					"smart_device_prefailures_above_threshold_in_past",
+					"Whether SMART has detected prefailure signals above threshold in the past",
 					[]string{"device"},
 					nil,
 				),
 				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
 					v := 0.
-					if output.SmartExitCodeOutput.DiskFailing {
+					if output.SmartExitCodeOutput.PrefailAboveThresholdInPast {
 						v = 1.
 					}
 					metrics <- prometheus.MustNewConstMetric(
@@ -381,14 +383,14 @@ func NewMetrics() *Metrics {
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_prefailures_above_threshold",
-					"Whether SMART has detected prefailure signals currently above threshold",
+					"smart_device_errors_logged",
+					"Whether the device has logged errors",
 					[]string{"device"},
 					nil,
 				),
 				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
 					v := 0.
-					if output.SmartExitCodeOutput.PrefailAboveThreshold {
+					if output.SmartExitCodeOutput.DeviceErrorsLogged {
 						v = 1.
 					}
 					metrics <- prometheus.MustNewConstMetric(
@@ -403,14 +405,14 @@ func NewMetrics() *Metrics {
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_prefailures_above_threshold_in_past",
-					"Whether SMART has detected prefailure signals above threshold in the past",
+					"smart_device_recent_self_test_errors",
+					"Whether a recent self test has failed",
 					[]string{"device"},
 					nil,
 				),
 				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
 					v := 0.
-					if output.SmartExitCodeOutput.PrefailAboveThresholdInPast {
+					if output.SmartExitCodeOutput.RecentSelfTestErrors {
 						v = 1.
 					}
 					metrics <- prometheus.MustNewConstMetric(
@@ -425,44 +427,303 @@ func NewMetrics() *Metrics {
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_errors_logged",
-					"Whether the device has logged errors",
+					"smart_device_statistic",
+					"Value of an entry in the ATA device statistics log",
+					[]string{"device", "page", "name"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					for _, p := range output.AtaDeviceStatistics.Pages {
+						for _, e := range p.Table {
+							if !e.Flags.Valid || e.Flags.Normalized {
+								continue
+							}
+							metrics <- prometheus.MustNewConstMetric(
+								desc,
+								prometheus.GaugeValue,
+								float64(e.Value),
+								output.Device.Name,
+								p.Name,
+								e.Name,
+							)
+						}
+					}
+
+					return nil
+				},
+			},
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					"smart_device_statistic_normalized",
+					"Normalized value of an entry in the ATA device statistics log",
+					[]string{"device", "page", "name"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					for _, p := range output.AtaDeviceStatistics.Pages {
+						for _, e := range p.Table {
+							if !e.Flags.Valid || !e.Flags.Normalized {
+								continue
+							}
+							metrics <- prometheus.MustNewConstMetric(
+								desc,
+								prometheus.GaugeValue,
+								float64(e.Value),
+								output.Device.Name,
+								p.Name,
+								e.Name,
+							)
+						}
+					}
+
+					return nil
+				},
+			},
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					"smart_farm_head_reallocated_sectors",
+					"Number of reallocated sectors per head from the Seagate FARM log",
+					[]string{"device", "head"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					for _, e := range output.SeagateFarmLog.Heads {
+						if e.Name != "reallocated_sectors" {
+							continue
+						}
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.GaugeValue,
+							e.Value,
+							output.Device.Name,
+							strconv.Itoa(e.Head),
+						)
+					}
+
+					return nil
+				},
+			},
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					"smart_farm_head_mr_resistance",
+					"MR head resistance per head from the Seagate FARM log",
+					[]string{"device", "head"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					for _, e := range output.SeagateFarmLog.Heads {
+						if !strings.HasPrefix(e.Name, "mr_head_resistance") {
+							continue
+						}
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.GaugeValue,
+							e.Value,
+							output.Device.Name,
+							strconv.Itoa(e.Head),
+						)
+					}
+
+					return nil
+				},
+			},
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					"smart_farm_head_fly_height_clearance_delta",
+					"Fly height clearance delta per head and zone from the Seagate FARM log",
+					[]string{"device", "head", "zone"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					for _, e := range output.SeagateFarmLog.Heads {
+						if !strings.HasPrefix(e.Name, "fly_height_clearance_delta") {
+							continue
+						}
+						zone := strings.TrimPrefix(strings.TrimPrefix(e.Name, "fly_height_clearance_delta"), "_")
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.GaugeValue,
+							e.Value,
+							output.Device.Name,
+							strconv.Itoa(e.Head),
+							zone,
+						)
+					}
+
+					return nil
+				},
+			},
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					"smart_nvme_namespace_size_bytes",
+					"Size of the NVMe namespace",
+					[]string{"device", "namespace"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					for _, n := range output.NvmeNamespaces {
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.GaugeValue,
+							float64(n.Size.Bytes),
+							output.Device.Name,
+							strconv.Itoa(n.Id),
+						)
+					}
+
+					return nil
+				},
+			},
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					"smart_nvme_namespace_capacity_bytes",
+					"Capacity of the NVMe namespace",
+					[]string{"device", "namespace"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					for _, n := range output.NvmeNamespaces {
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.GaugeValue,
+							float64(n.Capacity.Bytes),
+							output.Device.Name,
+							strconv.Itoa(n.Id),
+						)
+					}
+
+					return nil
+				},
+			},
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					"smart_nvme_namespace_utilization_bytes",
+					"Utilization of the NVMe namespace",
+					[]string{"device", "namespace"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					for _, n := range output.NvmeNamespaces {
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.GaugeValue,
+							float64(n.Utilization.Bytes),
+							output.Device.Name,
+							strconv.Itoa(n.Id),
+						)
+					}
+
+					return nil
+				},
+			},
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					"smart_nvme_error_log_error_count",
+					"Error count of the most recent entry in the NVMe error information log",
 					[]string{"device"},
 					nil,
 				),
 				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
-					v := 0.
-					if output.SmartExitCodeOutput.DeviceErrorsLogged {
-						v = 1.
+					if e, ok := latestNvmeError(output); ok {
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.GaugeValue,
+							float64(e.ErrorCount),
+							output.Device.Name,
+						)
 					}
-					metrics <- prometheus.MustNewConstMetric(
-						desc,
-						prometheus.GaugeValue,
-						v,
-						output.Device.Name,
-					)
 
 					return nil
 				},
 			},
 			&infoMetric{
 				PromDesc: prometheus.NewDesc(
-					"smart_device_recent_self_test_errors",
-					"Whether a recent self test has failed",
+					"smart_nvme_error_log_latest_lba",
+					"LBA of the most recent entry in the NVMe error information log",
+					[]string{"device", "namespace", "status"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					if e, ok := latestNvmeError(output); ok {
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.GaugeValue,
+							float64(e.Lba.Value),
+							output.Device.Name,
+							nvmeNamespaceLabel(e.Nsid),
+							e.StatusField.String,
+						)
+					}
+
+					return nil
+				},
+			},
+			newNvmeErrorLogMetric(),
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					MetricWrittenBytes,
+					"Total bytes written to the device",
 					[]string{"device"},
 					nil,
 				),
 				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
-					v := 0.
-					if output.SmartExitCodeOutput.RecentSelfTestErrors {
-						v = 1.
+					if v, ok := bytesWritten(output); ok {
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.CounterValue,
+							v,
+							output.Device.Name,
+						)
+					}
+
+					return nil
+				},
+			},
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					MetricLifeUsedPercent,
+					"Percentage of the rated endurance of the device which has been used",
+					[]string{"device"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					if v, ok := percentageLifeUsed(output); ok {
+						metrics <- prometheus.MustNewConstMetric(
+							desc,
+							prometheus.GaugeValue,
+							v,
+							output.Device.Name,
+						)
+					}
+
+					return nil
+				},
+			},
+			newEnduranceRemainingMetric(),
+			&infoMetric{
+				PromDesc: prometheus.NewDesc(
+					"smart_device_attribute_raw_component",
+					"Component of a vendor-specific packed ATA SMART attribute raw value",
+					[]string{"device", "attribute", "component"},
+					nil,
+				),
+				UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+					for _, e := range output.AtaSmartAttributes.Table {
+						components, ok := smartctl.DecodeRaw(output, e)
+						if !ok {
+							continue
+						}
+						for _, c := range components {
+							metrics <- prometheus.MustNewConstMetric(
+								desc,
+								prometheus.GaugeValue,
+								c.Value,
+								output.Device.Name,
+								e.Name,
+								c.Name,
+							)
+						}
 					}
-					metrics <- prometheus.MustNewConstMetric(
-						desc,
-						prometheus.GaugeValue,
-						v,
-						output.Device.Name,
-					)
 
 					return nil
 				},
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+)
+
+type nvmeErrorKey struct {
+	namespace string
+	status    string
+}
+
+// nvmeErrorLogMetric counts NVMe error information log entries which have appeared since the previous poll. The
+// error log is a ring buffer, so entries are identified by their error count, which increases monotonically.
+type nvmeErrorLogMetric struct {
+	desc           *prometheus.Desc
+	device         string
+	lastErrorCount int64
+	baselineSet    bool
+	counts         map[nvmeErrorKey]float64
+}
+
+func newNvmeErrorLogMetric() *nvmeErrorLogMetric {
+	return &nvmeErrorLogMetric{
+		desc: prometheus.NewDesc(
+			MetricNvmeErrorLogEntriesTotal,
+			"Number of new entries observed in the NVMe error information log",
+			[]string{"device", "namespace", "status"},
+			nil,
+		),
+		counts: map[nvmeErrorKey]float64{},
+	}
+}
+
+func (m *nvmeErrorLogMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *nvmeErrorLogMetric) Update(metrics chan<- prometheus.Metric) error {
+	for k, v := range m.counts {
+		metrics <- prometheus.MustNewConstMetric(
+			m.desc,
+			prometheus.CounterValue,
+			v,
+			m.device,
+			k.namespace,
+			k.status,
+		)
+	}
+	return nil
+}
+
+func (m *nvmeErrorLogMetric) UpdateFromInfo(info smartctl.InfoAllOutput) error {
+	m.device = info.Device.Name
+
+	table := info.NvmeErrorInformationLog.Table
+	if len(table) == 0 {
+		// an empty log is a baseline too, so the first errors to appear are counted
+		m.lastErrorCount = 0
+		m.baselineSet = true
+		return nil
+	}
+
+	tableMax := int64(0)
+	for _, e := range table {
+		if e.ErrorCount > tableMax {
+			tableMax = e.ErrorCount
+		}
+	}
+
+	// the first poll only establishes a baseline, as does an error count going backwards (e.g. a replaced device)
+	if m.baselineSet && tableMax >= m.lastErrorCount {
+		for _, e := range table {
+			if e.ErrorCount <= m.lastErrorCount {
+				continue
+			}
+			m.counts[nvmeErrorKey{
+				namespace: nvmeNamespaceLabel(e.Nsid),
+				status:    e.StatusField.String,
+			}]++
+		}
+	}
+
+	m.lastErrorCount = tableMax
+	m.baselineSet = true
+	return nil
+}
+
+func nvmeNamespaceLabel(nsid int64) string {
+	if nsid == 0xffffffff {
+		return "all"
+	}
+	return strconv.FormatInt(nsid, 10)
+}
+
+func latestNvmeError(info smartctl.InfoAllOutput) (smartctl.NvmeErrorInformationLogTable, bool) {
+	var latest smartctl.NvmeErrorInformationLogTable
+	found := false
+	for _, e := range info.NvmeErrorInformationLog.Table {
+		if !found || e.ErrorCount > latest.ErrorCount {
+			latest = e
+			found = true
+		}
+	}
+	return latest, found
+}
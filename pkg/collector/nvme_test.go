@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func nvmeErrorInfo(counts ...int64) smartctl.InfoAllOutput {
+	var info smartctl.InfoAllOutput
+	info.Device.Name = "/dev/nvme0"
+	for _, n := range counts {
+		e := smartctl.NvmeErrorInformationLogTable{ErrorCount: n, Nsid: 1}
+		e.StatusField.String = "Invalid Field in Command"
+		info.NvmeErrorInformationLog.Table = append(info.NvmeErrorInformationLog.Table, e)
+	}
+	return info
+}
+
+func nvmeErrorCounts(t *testing.T, m *nvmeErrorLogMetric) float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 10)
+	if err := m.Update(ch); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	total := 0.0
+	for metric := range ch {
+		var out dto.Metric
+		if err := metric.Write(&out); err != nil {
+			t.Fatal(err)
+		}
+		total += out.GetCounter().GetValue()
+	}
+	return total
+}
+
+func TestNvmeErrorLogMetric(t *testing.T) {
+	tests := []struct {
+		name  string
+		polls [][]int64
+		want  float64
+	}{
+		{"first poll is a baseline", [][]int64{{1, 2}}, 0},
+		{"new errors", [][]int64{{1, 2}, {1, 2, 3, 4}}, 2},
+		{"empty log then errors", [][]int64{{}, {1, 2}}, 2},
+		{"unchanged", [][]int64{{1, 2}, {1, 2}}, 0},
+		{"count going backwards resets the baseline", [][]int64{{5}, {1}, {1, 2}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newNvmeErrorLogMetric()
+			for _, counts := range tt.polls {
+				if err := m.UpdateFromInfo(nvmeErrorInfo(counts...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := nvmeErrorCounts(t, m); got != tt.want {
+				t.Errorf("got %v new errors, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"github.com/milesbxf/smartmon-exporter/pkg/risk"
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func riskMetrics(scorer *risk.Scorer) []PerDeviceInfoMetric {
+	return []PerDeviceInfoMetric{
+		&infoMetric{
+			PromDesc: prometheus.NewDesc(
+				MetricFailureRiskScore,
+				"Estimated failure risk of the device between 0 and 1, from known predictive attributes",
+				[]string{"device"},
+				nil,
+			),
+			UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+				metrics <- prometheus.MustNewConstMetric(
+					desc,
+					prometheus.GaugeValue,
+					scorer.Evaluate(output).Score,
+					output.Device.Name,
+				)
+				return nil
+			},
+		},
+		&infoMetric{
+			PromDesc: prometheus.NewDesc(
+				MetricRiskFactors,
+				"Weight contributed to the failure risk score by each triggered risk factor",
+				[]string{"device", "reason"},
+				nil,
+			),
+			UpdateFunc: func(metrics chan<- prometheus.Metric, output smartctl.InfoAllOutput, desc *prometheus.Desc) error {
+				for _, f := range scorer.Evaluate(output).Factors {
+					metrics <- prometheus.MustNewConstMetric(
+						desc,
+						prometheus.GaugeValue,
+						f.Weight,
+						output.Device.Name,
+						f.Reason,
+					)
+				}
+				return nil
+			},
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/config"
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+)
+
+// Intervals are the intervals at which each group of device information is polled.
+type Intervals map[smartctl.Group]config.Duration
+
+// DeviceSchedule configures how often each group of information is polled from one device. Groups it doesn't
+// configure are polled at the schedule's intervals.
+type DeviceSchedule struct {
+	Intervals Intervals `json:"intervals"`
+}
+
+// Schedule configures how often each group of device information is polled. Groups default to the poll interval,
+// which is also the shortest interval allowed.
+type Schedule struct {
+	Intervals Intervals `json:"intervals"`
+	// Devices overrides Intervals for devices, keyed by device name (e.g. /dev/sda) or serial number.
+	Devices map[string]DeviceSchedule `json:"devices"`
+}
+
+func LoadSchedule(path string) (*Schedule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schedule{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s Schedule) validate(pollInterval time.Duration) error {
+	check := func(intervals Intervals, where string) error {
+		for g, d := range intervals {
+			if !containsGroup(smartctl.Groups, g) {
+				return fmt.Errorf("%sunknown group %q", where, g)
+			}
+			if time.Duration(d) < pollInterval {
+				return fmt.Errorf("%sinterval %s for group %s is shorter than the poll interval %s",
+					where, time.Duration(d), g, pollInterval)
+			}
+		}
+		return nil
+	}
+	if err := check(s.Intervals, ""); err != nil {
+		return err
+	}
+	for name, d := range s.Devices {
+		if err := check(d.Intervals, fmt.Sprintf("device %s: ", name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interval returns how often group should be polled for d.
+func (s Schedule) interval(d *device, group smartctl.Group, pollInterval time.Duration) time.Duration {
+	interval := pollInterval
+	if v, ok := s.Intervals[group]; ok {
+		interval = time.Duration(v)
+	}
+	override, ok := s.Devices[d.name]
+	if !ok && d.info != nil && d.info.SerialNumber != "" {
+		override, ok = s.Devices[d.info.SerialNumber]
+	}
+	if v, ok := override.Intervals[group]; ok {
+		interval = time.Duration(v)
+	}
+	return interval
+}
+
+// dueGroups returns the groups of information to poll from d at now. Polls happen on ticks of the poll interval,
+// so a group is due if its next poll falls before the middle of the following interval.
+func (c *collector) dueGroups(d *device, now time.Time) []smartctl.Group {
+	groups := []smartctl.Group{}
+	for _, g := range smartctl.Groups {
+		last, ok := d.polled[g]
+		if !ok || now.Add(c.pollInterval/2).After(last.Add(c.schedule.interval(d, g, c.pollInterval))) {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/config"
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+)
+
+func TestLoadSchedule(t *testing.T) {
+	s, err := LoadSchedule("testdata/schedule.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Schedule{
+		Intervals: Intervals{
+			smartctl.GroupIdentity:   config.Duration(24 * time.Hour),
+			smartctl.GroupAttributes: config.Duration(15 * time.Minute),
+			smartctl.GroupLogs:       config.Duration(time.Hour),
+		},
+		Devices: map[string]DeviceSchedule{
+			"/dev/sdb": {Intervals: Intervals{smartctl.GroupAttributes: config.Duration(5 * time.Minute)}},
+			"ZL2XXXXX": {Intervals: Intervals{smartctl.GroupTemperature: config.Duration(2 * time.Minute)}},
+		},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+	if err := s.validate(time.Minute); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		err      string
+	}{
+		{"empty", `{}`, ""},
+		{"poll interval", `{"intervals": {"health": "1m"}}`, ""},
+		{"unknown group", `{"intervals": {"smart": "1h"}}`, `unknown group "smart"`},
+		{"shorter than poll interval", `{"intervals": {"health": "30s"}}`, "shorter than the poll interval"},
+		{"device unknown group", `{"devices": {"/dev/sda": {"intervals": {"farm": "1h"}}}}`, `device /dev/sda: unknown group "farm"`},
+		{"device shorter than poll interval", `{"devices": {"/dev/sda": {"intervals": {"logs": "10s"}}}}`, "device /dev/sda: interval 10s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "schedule.json")
+			if err := os.WriteFile(path, []byte(tt.schedule), 0644); err != nil {
+				t.Fatal(err)
+			}
+			s, err := LoadSchedule(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.validate(time.Minute)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadScheduleInvalidDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	if err := os.WriteFile(path, []byte(`{"intervals": {"health": "hourly"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSchedule(path); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
+
+func TestDueGroups(t *testing.T) {
+	s, err := LoadSchedule("testdata/schedule.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{pollInterval: time.Minute, schedule: *s}
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	// polledAt returns when each group was last polled, ago before now
+	polledAt := func(ago map[smartctl.Group]time.Duration) map[smartctl.Group]time.Time {
+		polled := map[smartctl.Group]time.Time{}
+		for g, d := range ago {
+			polled[g] = now.Add(-d)
+		}
+		return polled
+	}
+	serial := &smartctl.InfoAllOutput{SerialNumber: "ZL2XXXXX"}
+
+	tests := []struct {
+		name   string
+		device *device
+		want   []smartctl.Group
+	}{
+		{
+			"never polled",
+			&device{name: "/dev/sda"},
+			smartctl.Groups,
+		},
+		{
+			"polled one interval ago",
+			&device{name: "/dev/sda", polled: polledAt(map[smartctl.Group]time.Duration{
+				smartctl.GroupIdentity:    time.Minute,
+				smartctl.GroupHealth:      time.Minute,
+				smartctl.GroupAttributes:  time.Minute,
+				smartctl.GroupLogs:        time.Minute,
+				smartctl.GroupTemperature: time.Minute,
+			})},
+			[]smartctl.Group{smartctl.GroupHealth, smartctl.GroupTemperature},
+		},
+		{
+			// a poll slightly early due to ticker jitter still counts the group as due
+			"polled just under the group intervals ago",
+			&device{name: "/dev/sda", polled: polledAt(map[smartctl.Group]time.Duration{
+				smartctl.GroupIdentity:    24*time.Hour - time.Second,
+				smartctl.GroupHealth:      time.Minute - time.Second,
+				smartctl.GroupAttributes:  15*time.Minute - time.Second,
+				smartctl.GroupLogs:        59 * time.Minute,
+				smartctl.GroupTemperature: time.Minute,
+			})},
+			[]smartctl.Group{smartctl.GroupIdentity, smartctl.GroupHealth, smartctl.GroupAttributes, smartctl.GroupTemperature},
+		},
+		{
+			// health was last polled mid-interval, e.g. by a refresh, so isn't due until the following tick
+			"device override by name",
+			&device{name: "/dev/sdb", polled: polledAt(map[smartctl.Group]time.Duration{
+				smartctl.GroupIdentity:    time.Hour,
+				smartctl.GroupHealth:      30 * time.Second,
+				smartctl.GroupAttributes:  5 * time.Minute,
+				smartctl.GroupLogs:        time.Minute,
+				smartctl.GroupTemperature: time.Minute,
+			})},
+			[]smartctl.Group{smartctl.GroupAttributes, smartctl.GroupTemperature},
+		},
+		{
+			"device override by serial number",
+			&device{name: "/dev/sdc", info: serial, polled: polledAt(map[smartctl.Group]time.Duration{
+				smartctl.GroupIdentity:    time.Hour,
+				smartctl.GroupHealth:      time.Minute,
+				smartctl.GroupAttributes:  time.Minute,
+				smartctl.GroupLogs:        time.Minute,
+				smartctl.GroupTemperature: time.Minute,
+			})},
+			[]smartctl.Group{smartctl.GroupHealth},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.dueGroups(tt.device, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// minRescanInterval limits how often devices are rescanned to check whether devices which stopped responding have
+// been removed.
+const minRescanInterval = 10 * time.Minute
+
+// lastSeen is when d was last polled successfully, or when it was found if it never has been.
+func (d *device) lastSeen() time.Time {
+	if d.lastSuccess.IsZero() {
+		return d.added
+	}
+	return d.lastSuccess
+}
+
+// stale reports whether d's data is too old to export, with a staleness TTL of ttl. Zero disables the TTL.
+func (d *device) stale(now time.Time, ttl time.Duration) bool {
+	return ttl > 0 && now.Sub(d.lastSeen()) > ttl
+}
+
+// up reports whether the last poll of d succeeded and its data is current.
+func (d *device) up(now time.Time, ttl time.Duration) bool {
+	return d.info != nil && d.lastErr == nil && !d.stale(now, ttl)
+}
+
+// collectGarbage rescans devices if any haven't been seen for the removal TTL, removing those no longer found and
+// adding any new ones.
+func (c *collector) collectGarbage(now time.Time) {
+	if c.removalTTL <= 0 || now.Sub(c.lastScan) < minRescanInterval {
+		return
+	}
+	expired := false
+	for _, d := range c.devices {
+		if now.Sub(d.lastSeen()) > c.removalTTL {
+			expired = true
+		}
+	}
+	if !expired {
+		return
+	}
+
+	scan, err := c.smart.ScanOpen()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to rescan devices")
+		return
+	}
+	c.lastScan = now
+	found := map[string]bool{}
+	for _, d := range scan.Devices {
+		found[d.Name] = true
+	}
+
+	devices := c.devices[:0]
+	known := map[string]bool{}
+	for _, d := range c.devices {
+		if !found[d.name] && now.Sub(d.lastSeen()) > c.removalTTL {
+			c.removeDevice(d)
+			continue
+		}
+		known[d.name] = true
+		devices = append(devices, d)
+	}
+	c.devices = devices
+	for _, d := range scan.Devices {
+		if !known[d.Name] {
+			c.addDevice(d.Name, now)
+		}
+	}
+}
+
+func (c *collector) removeDevice(d *device) {
+	d.logger().Info().Time("last_seen", d.lastSeen()).Msg("removing device which is no longer present")
+	c.failures.DeleteLabelValues(d.name)
+	c.backoff.DeleteLabelValues(d.name)
+	for attribute := range d.changedAttributes {
+		c.changes.DeleteLabelValues(d.name, attribute)
+	}
+	c.smart.Forget(d.name)
+}
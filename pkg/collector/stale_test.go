@@ -0,0 +1,245 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gather returns the value of each metric collected from c by name and then device.
+func gather(t *testing.T, c *collector) map[string]map[string]float64 {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]map[string]float64{}
+	for _, f := range families {
+		values[f.GetName()] = map[string]float64{}
+		for _, m := range f.Metric {
+			device := ""
+			for _, l := range m.Label {
+				if l.GetName() == "device" {
+					device = l.GetValue()
+				}
+			}
+			v := m.GetGauge().GetValue() + m.GetCounter().GetValue() + m.GetUntyped().GetValue()
+			values[f.GetName()][device] = v
+		}
+	}
+	return values
+}
+
+// has reports whether a metric name was gathered for device.
+func has(values map[string]map[string]float64, name, device string) bool {
+	_, ok := values[name][device]
+	return ok
+}
+
+func TestStaleDeviceMetrics(t *testing.T) {
+	smart := newFakeSmartCtl("/dev/sda")
+	c := newTestCollector(t, smart, WithStaleness(5*time.Minute, 0))
+	if err := pollAll(c); err != nil {
+		t.Fatal(err)
+	}
+	values := gather(t, c)
+	if values[MetricDeviceUp]["/dev/sda"] != 1 || !has(values, MetricTemperature, "/dev/sda") || !has(values, MetricDataAgeSeconds, "/dev/sda") {
+		t.Fatalf("healthy device isn't exported: %v", values)
+	}
+
+	// a failed poll marks the device down, but its last metrics are exported until they're stale
+	smart.setFailing("/dev/sda", true)
+	if err := pollAll(c); err == nil {
+		t.Fatal("expected the poll to fail")
+	}
+	values = gather(t, c)
+	if values[MetricDeviceUp]["/dev/sda"] != 0 {
+		t.Errorf("got %s %v after a failed poll, want 0", MetricDeviceUp, values[MetricDeviceUp]["/dev/sda"])
+	}
+	if !has(values, MetricTemperature, "/dev/sda") || !has(values, MetricDataAgeSeconds, "/dev/sda") {
+		t.Error("metrics were suppressed before the stale TTL")
+	}
+
+	c.devices[0].lastSuccess = time.Now().Add(-6 * time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := pollAll(c); err == nil {
+			t.Fatal("expected the poll to fail")
+		}
+		values = gather(t, c)
+		if v, ok := values[MetricDeviceUp]["/dev/sda"]; !ok || v != 0 {
+			t.Errorf("got %s %v (exported %v) for a stale device, want 0", MetricDeviceUp, v, ok)
+		}
+		for _, name := range []string{MetricTemperature, MetricSmartStatusPassed, MetricDataAgeSeconds} {
+			if has(values, name, "/dev/sda") {
+				t.Errorf("%s is exported for a stale device", name)
+			}
+		}
+		if !has(values, MetricConsecutiveFailures, "/dev/sda") {
+			t.Errorf("%s isn't exported for a stale device", MetricConsecutiveFailures)
+		}
+	}
+
+	smart.setFailing("/dev/sda", false)
+	if err := pollAll(c); err != nil {
+		t.Fatal(err)
+	}
+	values = gather(t, c)
+	if values[MetricDeviceUp]["/dev/sda"] != 1 || !has(values, MetricTemperature, "/dev/sda") || !has(values, MetricDataAgeSeconds, "/dev/sda") {
+		t.Errorf("recovered device isn't exported: %v", values)
+	}
+}
+
+func TestDeviceRemoval(t *testing.T) {
+	tests := []struct {
+		name     string
+		lastSeen time.Duration
+		scanned  bool
+		removed  bool
+	}{
+		{"missing for longer than the removal TTL", 2 * time.Hour, false, true},
+		{"missing for less than the removal TTL", 30 * time.Minute, false, false},
+		{"still found by a rescan", 2 * time.Hour, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smart := newFakeSmartCtl("/dev/sda", "/dev/sdb")
+			c := newTestCollector(t, smart, WithStaleness(5*time.Minute, time.Hour))
+			if err := pollAll(c); err != nil {
+				t.Fatal(err)
+			}
+
+			smart.setFailing("/dev/sda", true)
+			if tt.scanned {
+				smart.setDevices("/dev/sda", "/dev/sdb", "/dev/sdc")
+			} else {
+				smart.setDevices("/dev/sdb", "/dev/sdc")
+			}
+			c.devices[0].lastSuccess = time.Now().Add(-tt.lastSeen)
+			c.lastScan = time.Now().Add(-minRescanInterval)
+			_ = pollAll(c)
+
+			names := []string{}
+			for _, d := range c.devices {
+				names = append(names, d.name)
+			}
+			values := gather(t, c)
+			if !tt.removed {
+				if names[0] != "/dev/sda" || !has(values, MetricDeviceUp, "/dev/sda") {
+					t.Errorf("device was removed: got devices %v", names)
+				}
+				return
+			}
+
+			// devices found by the rescan are added as the missing one is removed
+			if want := []string{"/dev/sdb", "/dev/sdc"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("got devices %v, want %v", names, want)
+			}
+			for _, name := range []string{MetricDeviceUp, MetricConsecutiveFailures, MetricBackoffSeconds, MetricTemperature} {
+				if has(values, name, "/dev/sda") {
+					t.Errorf("%s is still exported for a removed device", name)
+				}
+			}
+			if !reflect.DeepEqual(smart.forgotten, []string{"/dev/sda"}) {
+				t.Errorf("got forgotten devices %v, want smartctl state for /dev/sda forgotten", smart.forgotten)
+			}
+		})
+	}
+}
+
+func TestStaleTTLValidation(t *testing.T) {
+	tests := []struct {
+		staleTTL time.Duration
+		valid    bool
+	}{
+		{0, true},
+		{2 * time.Minute, true},
+		{time.Minute, false},
+		{30 * time.Second, false},
+	}
+	for _, tt := range tests {
+		_, err := New(newFakeSmartCtl(), time.Minute, WithStaleness(tt.staleTTL, 0))
+		if (err == nil) != tt.valid {
+			t.Errorf("stale TTL %s: got error %v, want valid %v", tt.staleTTL, err, tt.valid)
+		}
+	}
+}
+
+type eventRecorder struct {
+	events []events.Event
+}
+
+func (r *eventRecorder) Publish(evs ...events.Event) {
+	r.events = append(r.events, evs...)
+}
+
+func TestDeviceReplaced(t *testing.T) {
+	smart := newFakeSmartCtl("/dev/sda")
+	recorder := &eventRecorder{}
+	c := newTestCollector(t, smart, WithEvents(recorder))
+	if err := pollAll(c); err != nil {
+		t.Fatal(err)
+	}
+	initial := len(recorder.events)
+	if initial == 0 {
+		t.Fatal("no initial events for the first poll")
+	}
+
+	// a different drive is found at the same device when its identity is next polled
+	smart.setSerial("/dev/sda", "REPLACEMENT")
+	if err := pollAll(c); err != nil {
+		t.Fatal(err)
+	}
+	replaced := recorder.events[initial:]
+	if len(replaced) != initial {
+		t.Errorf("got %d events for the replacement drive, want %d initial events", len(replaced), initial)
+	}
+	for _, e := range replaced {
+		if !e.Initial || e.Identity != "_REPLACEMENT" {
+			t.Errorf("got event %+v, want initial events for the replacement drive", e)
+		}
+	}
+}
+
+func TestDeviceOpenFailureGoesStale(t *testing.T) {
+	smart := newFakeSmartCtl("/dev/sda")
+	recorder := &eventRecorder{}
+	c := newTestCollector(t, smart, WithEvents(recorder), WithStaleness(5*time.Minute, 0), WithMaxBackoff(0))
+	if err := pollAll(c); err != nil {
+		t.Fatal(err)
+	}
+	initial := len(recorder.events)
+	lastSuccess := c.devices[0].lastSuccess
+
+	// smartctl outputs JSON without the device's identity when it can't open it, which mustn't count as a success
+	// or as a different drive
+	smart.setFailing("/dev/sda", true)
+	for i := 0; i < 3; i++ {
+		if err := pollAll(c); err == nil {
+			t.Fatal("expected the poll to fail")
+		}
+	}
+	d := c.devices[0]
+	if !d.lastSuccess.Equal(lastSuccess) {
+		t.Errorf("last success moved from %s to %s on failed polls", lastSuccess, d.lastSuccess)
+	}
+	if d.info.SerialNumber == "" {
+		t.Error("the failed polls' output replaced the device's information")
+	}
+	if len(recorder.events) != initial {
+		t.Errorf("got events %+v for failed polls, want none", recorder.events[initial:])
+	}
+
+	d.lastSuccess = time.Now().Add(-6 * time.Minute)
+	if err := pollAll(c); err == nil {
+		t.Fatal("expected the poll to fail")
+	}
+	values := gather(t, c)
+	if values[MetricDeviceUp]["/dev/sda"] != 0 || has(values, MetricTemperature, "/dev/sda") {
+		t.Errorf("device failing to open isn't stale: %v", values)
+	}
+}
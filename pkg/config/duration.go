@@ -0,0 +1,23 @@
+// Package config holds types shared by the exporter's JSON configuration files.
+package config
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration is a time.Duration which unmarshals from a Go duration string such as "1m30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,253 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/collector"
+	"io"
+)
+
+type Config struct {
+	Title string
+	UID   string
+	// Job is the Prometheus job label of the exporter's scrape targets.
+	Job string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Title: "SMART devices",
+		UID:   "smartmon-exporter",
+		Job:   "smartmon",
+	}
+}
+
+type Dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	Timezone      string     `json:"timezone"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          TimeRange  `json:"time"`
+	Templating    Templating `json:"templating"`
+	Panels        []Panel    `json:"panels"`
+}
+
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+type Variable struct {
+	Name       string      `json:"name"`
+	Label      string      `json:"label"`
+	Type       string      `json:"type"`
+	Query      interface{} `json:"query"`
+	Datasource *Datasource `json:"datasource,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+	Multi      bool        `json:"multi"`
+	IncludeAll bool        `json:"includeAll"`
+	AllValue   string      `json:"allValue,omitempty"`
+}
+
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	Format       string `json:"format,omitempty"`
+	Instant      bool   `json:"instant,omitempty"`
+}
+
+type Panel struct {
+	ID              int                    `json:"id"`
+	Title           string                 `json:"title"`
+	Type            string                 `json:"type"`
+	Datasource      *Datasource            `json:"datasource,omitempty"`
+	GridPos         GridPos                `json:"gridPos"`
+	Targets         []Target               `json:"targets,omitempty"`
+	FieldConfig     map[string]interface{} `json:"fieldConfig,omitempty"`
+	Transformations []interface{}          `json:"transformations,omitempty"`
+}
+
+var datasource = &Datasource{Type: "prometheus", UID: "${datasource}"}
+
+// selector restricts a metric to the host and device template variables.
+func selector(metric string) string {
+	return fmt.Sprintf(`%s{instance=~"$host", device=~"$device"}`, metric)
+}
+
+func unit(u string) map[string]interface{} {
+	return map[string]interface{}{
+		"defaults":  map[string]interface{}{"unit": u},
+		"overrides": []interface{}{},
+	}
+}
+
+func timeseries(title, u string, pos GridPos, targets ...Target) Panel {
+	return Panel{
+		Title:       title,
+		Type:        "timeseries",
+		Datasource:  datasource,
+		GridPos:     pos,
+		Targets:     targets,
+		FieldConfig: unit(u),
+	}
+}
+
+func fleetHealthTable(pos GridPos) Panel {
+	instant := func(refID, metric string) Target {
+		return Target{RefID: refID, Expr: selector(metric), Format: "table", Instant: true}
+	}
+	return Panel{
+		Title:      "Fleet health",
+		Type:       "table",
+		Datasource: datasource,
+		GridPos:    pos,
+		Targets: []Target{
+			instant("info", collector.MetricDeviceInfo),
+			instant("passed", collector.MetricSmartStatusPassed),
+			instant("failing", collector.MetricDiskFailing),
+			instant("prefail", collector.MetricPrefailuresAboveThreshold),
+			instant("temperature", collector.MetricTemperature),
+			instant("risk", collector.MetricFailureRiskScore),
+			instant("wear", collector.MetricLifeUsedPercent),
+		},
+		Transformations: []interface{}{
+			map[string]interface{}{
+				"id":      "merge",
+				"options": map[string]interface{}{},
+			},
+			map[string]interface{}{
+				"id": "organize",
+				"options": map[string]interface{}{
+					"excludeByName": map[string]bool{"Time": true, "__name__": true, "job": true, "Value #info": true},
+					"renameByName": map[string]string{
+						"Value #passed":      "SMART passed",
+						"Value #failing":     "Disk failing",
+						"Value #prefail":     "Prefail above threshold",
+						"Value #temperature": "Temperature",
+						"Value #risk":        "Failure risk",
+						"Value #wear":        "Life used %",
+					},
+				},
+			},
+		},
+	}
+}
+
+func Generate(cfg Config) Dashboard {
+	panels := []Panel{
+		fleetHealthTable(GridPos{H: 10, W: 24, X: 0, Y: 0}),
+		timeseries("Temperature", "celsius", GridPos{H: 8, W: 12, X: 0, Y: 10},
+			Target{RefID: "A", Expr: selector(collector.MetricTemperature), LegendFormat: "{{instance}} {{device}}"},
+		),
+		timeseries("Failure risk score", "percentunit", GridPos{H: 8, W: 12, X: 12, Y: 10},
+			Target{RefID: "A", Expr: selector(collector.MetricFailureRiskScore), LegendFormat: "{{instance}} {{device}}"},
+		),
+		timeseries("Attribute changes", "short", GridPos{H: 8, W: 12, X: 0, Y: 18},
+			Target{
+				RefID:        "A",
+				Expr:         fmt.Sprintf("increase(%s[$__rate_interval])", selector(collector.MetricAttributeChangesTotal)),
+				LegendFormat: "{{instance}} {{device}} {{attribute}}",
+			},
+		),
+		timeseries("Risk factors", "short", GridPos{H: 8, W: 12, X: 12, Y: 18},
+			Target{RefID: "A", Expr: selector(collector.MetricRiskFactors), LegendFormat: "{{instance}} {{device}} {{reason}}"},
+		),
+		timeseries("SSD life used", "percent", GridPos{H: 8, W: 8, X: 0, Y: 26},
+			Target{RefID: "A", Expr: selector(collector.MetricLifeUsedPercent), LegendFormat: "{{instance}} {{device}}"},
+		),
+		timeseries("SSD estimated life remaining", "d", GridPos{H: 8, W: 8, X: 8, Y: 26},
+			Target{RefID: "A", Expr: selector(collector.MetricEstimatedLifeRemainingDays), LegendFormat: "{{instance}} {{device}}"},
+		),
+		timeseries("Write rate", "Bps", GridPos{H: 8, W: 8, X: 16, Y: 26},
+			Target{
+				RefID:        "A",
+				Expr:         fmt.Sprintf("rate(%s[$__rate_interval])", selector(collector.MetricWrittenBytes)),
+				LegendFormat: "{{instance}} {{device}}",
+			},
+		),
+		timeseries("NVMe error log entries", "short", GridPos{H: 8, W: 12, X: 0, Y: 34},
+			Target{
+				RefID:        "A",
+				Expr:         fmt.Sprintf("increase(%s[$__rate_interval])", selector(collector.MetricNvmeErrorLogEntriesTotal)),
+				LegendFormat: "{{instance}} {{device}} {{status}}",
+			},
+		),
+		timeseries("Poll health", "short", GridPos{H: 8, W: 12, X: 12, Y: 34},
+			Target{RefID: "A", Expr: fmt.Sprintf(`up{job="%s", instance=~"$host"}`, cfg.Job), LegendFormat: "{{instance}} up"},
+			Target{RefID: "B", Expr: selector(collector.MetricOpenFailure), LegendFormat: "{{instance}} {{device}} open failure"},
+			Target{RefID: "C", Expr: selector(collector.MetricCommandFailure), LegendFormat: "{{instance}} {{device}} command failure"},
+			Target{RefID: "D", Expr: selector(collector.MetricConsecutiveFailures), LegendFormat: "{{instance}} {{device}} consecutive failures"},
+		),
+	}
+	for i := range panels {
+		panels[i].ID = i + 1
+	}
+
+	return Dashboard{
+		UID:           cfg.UID,
+		Title:         cfg.Title,
+		Tags:          []string{"smart", "smartmon-exporter"},
+		Timezone:      "browser",
+		SchemaVersion: 36,
+		Refresh:       "1m",
+		Time:          TimeRange{From: "now-24h", To: "now"},
+		Templating: Templating{
+			List: []Variable{
+				{
+					Name:  "datasource",
+					Label: "Data source",
+					Type:  "datasource",
+					Query: "prometheus",
+				},
+				{
+					Name:       "host",
+					Label:      "Host",
+					Type:       "query",
+					Datasource: datasource,
+					Query:      fmt.Sprintf(`label_values(%s{job="%s"}, instance)`, collector.MetricDeviceInfo, cfg.Job),
+					Refresh:    2,
+					Multi:      true,
+					IncludeAll: true,
+					AllValue:   ".*",
+				},
+				{
+					Name:       "device",
+					Label:      "Device",
+					Type:       "query",
+					Datasource: datasource,
+					Query:      fmt.Sprintf(`label_values(%s{job="%s", instance=~"$host"}, device)`, collector.MetricDeviceInfo, cfg.Job),
+					Refresh:    2,
+					Multi:      true,
+					IncludeAll: true,
+					AllValue:   ".*",
+				},
+			},
+		},
+		Panels: panels,
+	}
+}
+
+func Write(w io.Writer, d Dashboard) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(d)
+}
@@ -0,0 +1,221 @@
+package events
+
+import (
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// Event records a change in a device attribute between two consecutive polls, or the initial state of a health flag
+// when a device is first polled.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Device    string    `json:"device"`
+	Identity  string    `json:"identity"`
+	Attribute string    `json:"attribute"`
+	Old       int64     `json:"old"`
+	New       int64     `json:"new"`
+	Delta     int64     `json:"delta"`
+	// Initial marks an event reporting the state of a health flag on the first poll, rather than a change.
+	Initial bool `json:"initial,omitempty"`
+}
+
+// DefaultIgnoredAttributes are ATA attributes which change during normal operation and would swamp the event stream.
+var DefaultIgnoredAttributes = []string{
+	"Power_On_Hours",
+	"Temperature_Celsius",
+	"Airflow_Temperature_Cel",
+	"Head_Flying_Hours",
+	"Total_LBAs_Written",
+	"Total_LBAs_Read",
+	"Raw_Read_Error_Rate",
+	"Seek_Error_Rate",
+	"Hardware_ECC_Recovered",
+}
+
+type Detector struct {
+	ignored map[string]bool
+}
+
+func NewDetector(ignoredAttributes []string) *Detector {
+	ignored := map[string]bool{}
+	for _, a := range ignoredAttributes {
+		ignored[a] = true
+	}
+	return &Detector{ignored: ignored}
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func healthFlags(info smartctl.InfoAllOutput) map[string]int64 {
+	return map[string]int64{
+		"smart_status_passed":          boolValue(info.SmartStatus.Passed),
+		"disk_failing":                 boolValue(info.SmartExitCodeOutput.DiskFailing),
+		"prefail_above_threshold":      boolValue(info.SmartExitCodeOutput.PrefailAboveThreshold),
+		"prefail_above_threshold_past": boolValue(info.SmartExitCodeOutput.PrefailAboveThresholdInPast),
+		"device_errors_logged":         boolValue(info.SmartExitCodeOutput.DeviceErrorsLogged),
+		"recent_self_test_errors":      boolValue(info.SmartExitCodeOutput.RecentSelfTestErrors),
+	}
+}
+
+// values flattens the attributes of interest in info. ATA attributes are keyed by name and use their raw value;
+// health flags and NVMe health log fields are prefixed to avoid clashing with them.
+func (d *Detector) values(info smartctl.InfoAllOutput) map[string]int64 {
+	values := healthFlags(info)
+	for _, e := range info.AtaSmartAttributes.Table {
+		if d.ignored[e.Name] {
+			continue
+		}
+		values[e.Name] = int64(e.Raw.Value)
+	}
+	if info.Device.Protocol == "NVMe" {
+		h := info.NvmeSmartHealthInformationLog
+		values["nvme_critical_warning"] = int64(h.CriticalWarning)
+		values["nvme_available_spare"] = int64(h.AvailableSpare)
+		values["nvme_percentage_used"] = int64(h.PercentageUsed)
+		values["nvme_media_errors"] = h.MediaErrors
+		values["nvme_num_err_log_entries"] = h.NumErrLogEntries
+	}
+	return values
+}
+
+// Initial returns an event for each health flag of a device's first poll, so that consumers learn about devices which
+// were already failing.
+func (d *Detector) Initial(cur smartctl.InfoAllOutput, t time.Time) []Event {
+	events := []Event{}
+	for name, v := range healthFlags(cur) {
+		events = append(events, Event{
+			Time:      t,
+			Device:    cur.Device.Name,
+			Identity:  cur.Identity(),
+			Attribute: name,
+			Old:       v,
+			New:       v,
+			Initial:   true,
+		})
+	}
+	return events
+}
+
+// Diff returns an event for every attribute whose value differs between prev and cur.
+func (d *Detector) Diff(prev, cur smartctl.InfoAllOutput, t time.Time) []Event {
+	old := d.values(prev)
+	events := []Event{}
+	for name, v := range d.values(cur) {
+		o, ok := old[name]
+		if !ok || o == v {
+			continue
+		}
+		events = append(events, Event{
+			Time:      t,
+			Device:    cur.Device.Name,
+			Identity:  cur.Identity(),
+			Attribute: name,
+			Old:       o,
+			New:       v,
+			Delta:     v - o,
+		})
+	}
+	return events
+}
+
+// Broker keeps the most recent change events and fans new events out to subscribers.
+type Broker struct {
+	mu     sync.RWMutex
+	size   int
+	recent []Event
+	// subscribers maps each subscriber's channel to whether it receives initial events
+	subscribers map[chan Event]bool
+	dropped     prometheus.Counter
+}
+
+// NewBroker returns a broker retaining the size most recent change events. A negative size retains none.
+func NewBroker(size int) *Broker {
+	if size < 0 {
+		size = 0
+	}
+	return &Broker{
+		size:        size,
+		subscribers: map[chan Event]bool{},
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "smart_events_dropped_total",
+			Help: "Number of events not delivered to subscribers which couldn't keep up",
+		}),
+	}
+}
+
+func (b *Broker) Describe(descs chan<- *prometheus.Desc) {
+	b.dropped.Describe(descs)
+}
+
+func (b *Broker) Collect(metrics chan<- prometheus.Metric) {
+	b.dropped.Collect(metrics)
+}
+
+// Publish retains change events and sends events to subscribers, dropping them for subscribers which can't keep up
+// so that it never blocks. Initial events aren't changes, so are neither retained nor sent to subscribers from
+// Subscribe.
+func (b *Broker) Publish(events ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range events {
+		if !e.Initial {
+			b.recent = append(b.recent, e)
+		}
+	}
+	if len(b.recent) > b.size {
+		b.recent = b.recent[len(b.recent)-b.size:]
+	}
+	for ch, initial := range b.subscribers {
+		for _, e := range events {
+			if e.Initial && !initial {
+				continue
+			}
+			select {
+			case ch <- e:
+			default:
+				b.dropped.Inc()
+			}
+		}
+	}
+}
+
+// Recent returns the retained change events, oldest first.
+func (b *Broker) Recent() []Event {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]Event{}, b.recent...)
+}
+
+// Subscribe returns a channel receiving change events published from now on, and a function to cancel the
+// subscription. Events are dropped if the channel isn't drained quickly enough.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	return b.subscribe(64, false)
+}
+
+// SubscribeWithInitial is like Subscribe, but also receives initial events, and buffers up to size events so that
+// a subscriber which is briefly busy doesn't miss any.
+func (b *Broker) SubscribeWithInitial(size int) (<-chan Event, func()) {
+	return b.subscribe(size, true)
+}
+
+func (b *Broker) subscribe(size int, initial bool) (<-chan Event, func()) {
+	ch := make(chan Event, size)
+	b.mu.Lock()
+	b.subscribers[ch] = initial
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func ataInfo(passed bool, prefail bool, attributes map[string]int) smartctl.InfoAllOutput {
+	var info smartctl.InfoAllOutput
+	info.Device.Name = "/dev/sda"
+	info.Device.Protocol = "ATA"
+	info.SmartStatus.Passed = passed
+	info.SmartExitCodeOutput.PrefailAboveThreshold = prefail
+	for name, raw := range attributes {
+		e := smartctl.AtaSmartAttributesTable{Name: name}
+		e.Raw.Value = raw
+		info.AtaSmartAttributes.Table = append(info.AtaSmartAttributes.Table, e)
+	}
+	return info
+}
+
+func TestDiff(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		prev smartctl.InfoAllOutput
+		cur  smartctl.InfoAllOutput
+		want []Event
+	}{
+		{
+			name: "unchanged",
+			prev: ataInfo(true, false, map[string]int{"Reallocated_Sector_Ct": 8}),
+			cur:  ataInfo(true, false, map[string]int{"Reallocated_Sector_Ct": 8}),
+			want: []Event{},
+		},
+		{
+			name: "counter increase",
+			prev: ataInfo(true, false, map[string]int{"Reallocated_Sector_Ct": 8}),
+			cur:  ataInfo(true, false, map[string]int{"Reallocated_Sector_Ct": 24}),
+			want: []Event{{Attribute: "Reallocated_Sector_Ct", Old: 8, New: 24, Delta: 16}},
+		},
+		{
+			name: "threshold crossing",
+			prev: ataInfo(true, false, nil),
+			cur:  ataInfo(true, true, nil),
+			want: []Event{{Attribute: "prefail_above_threshold", Old: 0, New: 1, Delta: 1}},
+		},
+		{
+			name: "health check failing",
+			prev: ataInfo(true, false, nil),
+			cur:  ataInfo(false, false, nil),
+			want: []Event{{Attribute: "smart_status_passed", Old: 1, New: 0, Delta: -1}},
+		},
+		{
+			name: "ignored attribute",
+			prev: ataInfo(true, false, map[string]int{"Power_On_Hours": 100}),
+			cur:  ataInfo(true, false, map[string]int{"Power_On_Hours": 101}),
+			want: []Event{},
+		},
+		{
+			name: "new attribute",
+			prev: ataInfo(true, false, nil),
+			cur:  ataInfo(true, false, map[string]int{"Reallocated_Sector_Ct": 8}),
+			want: []Event{},
+		},
+	}
+	d := NewDetector(DefaultIgnoredAttributes)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.want {
+				tt.want[i].Time = now
+				tt.want[i].Device = "/dev/sda"
+				tt.want[i].Identity = "/dev/sda"
+			}
+			got := d.Diff(tt.prev, tt.cur, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrokerRetention(t *testing.T) {
+	b := NewBroker(3)
+	for i := int64(1); i <= 5; i++ {
+		b.Publish(Event{Attribute: "Reallocated_Sector_Ct", New: i})
+	}
+	got := []int64{}
+	for _, e := range b.Recent() {
+		got = append(got, e.New)
+	}
+	if want := []int64{3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got retained events %v, want %v", got, want)
+	}
+
+	if got := NewBroker(-1); len(got.Recent()) != 0 {
+		t.Errorf("broker retaining no events has %d events", len(got.Recent()))
+	}
+}
+
+func TestBrokerDropsForSlowSubscribers(t *testing.T) {
+	b := NewBroker(100)
+	slow, cancelSlow := b.SubscribeWithInitial(2)
+	defer cancelSlow()
+	fast, cancelFast := b.Subscribe()
+	defer cancelFast()
+
+	// nothing reads from the subscriptions, so this would block if publishing waited for subscribers
+	for i := int64(1); i <= 5; i++ {
+		b.Publish(Event{Attribute: "Reallocated_Sector_Ct", New: i})
+	}
+
+	if got := testutil.ToFloat64(b.dropped); got != 3 {
+		t.Errorf("got %v dropped events, want 3", got)
+	}
+	if len(slow) != 2 || len(fast) != 5 {
+		t.Errorf("got %d and %d buffered events, want 2 and 5", len(slow), len(fast))
+	}
+	if len(b.Recent()) != 5 {
+		t.Errorf("got %d retained events, want all 5 despite the drops", len(b.Recent()))
+	}
+}
+
+func TestBrokerInitialEvents(t *testing.T) {
+	b := NewBroker(10)
+	changes, cancelChanges := b.Subscribe()
+	defer cancelChanges()
+	all, cancelAll := b.SubscribeWithInitial(10)
+	defer cancelAll()
+
+	initial := Event{Device: "/dev/sda", Attribute: "disk_failing", Old: 1, New: 1, Initial: true}
+	change := Event{Device: "/dev/sda", Attribute: "Reallocated_Sector_Ct", Old: 0, New: 8, Delta: 8}
+	b.Publish(initial, change)
+
+	if got := b.Recent(); len(got) != 1 || got[0] != change {
+		t.Errorf("got recent events %+v, want only the change", got)
+	}
+	if got := <-changes; got != change {
+		t.Errorf("subscriber got %+v, want only the change", got)
+	}
+	if len(changes) != 0 {
+		t.Errorf("subscriber got %d more events, want none", len(changes))
+	}
+	for _, want := range []Event{initial, change} {
+		if got := <-all; got != want {
+			t.Errorf("notifier subscriber got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestBrokerUnsubscribe(t *testing.T) {
+	b := NewBroker(10)
+	ch, cancel := b.Subscribe()
+	cancel()
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed after cancelling the subscription")
+	}
+	b.Publish(Event{Attribute: "Reallocated_Sector_Ct", New: 1})
+}
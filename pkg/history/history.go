@@ -0,0 +1,209 @@
+package history
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+	"strconv"
+	"time"
+)
+
+type Options struct {
+	// Retention is how long snapshots are kept for. Zero keeps snapshots forever.
+	Retention time.Duration
+	// CompactAfter is the age after which snapshots are thinned out to one per CompactResolution. Zero for either
+	// disables thinning.
+	CompactAfter      time.Duration
+	CompactResolution time.Duration
+}
+
+type Snapshot struct {
+	Time time.Time              `json:"time"`
+	Info smartctl.InfoAllOutput `json:"info"`
+}
+
+type AttributePoint struct {
+	Time   time.Time `json:"time"`
+	Value  int       `json:"value"`
+	Worst  int       `json:"worst"`
+	Thresh int       `json:"thresh"`
+	Raw    int       `json:"raw"`
+}
+
+// Store persists InfoAllOutput snapshots in a BoltDB file, with one bucket per device identity keyed by timestamp.
+type Store struct {
+	db     *bolt.DB
+	opts   Options
+	logger zerolog.Logger
+}
+
+func Open(path string, opts Options) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		db:     db,
+		opts:   opts,
+		logger: log.With().Str("component", "history").Logger(),
+	}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func timeKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return k
+}
+
+func keyTime(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+}
+
+func (s *Store) Put(info smartctl.InfoAllOutput, t time.Time) error {
+	v, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(info.Identity()))
+		if err != nil {
+			return err
+		}
+		return b.Put(timeKey(t), v)
+	})
+}
+
+// Devices returns the identities of all devices with stored snapshots.
+func (s *Store) Devices() ([]string, error) {
+	devices := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			devices = append(devices, string(name))
+			return nil
+		})
+	})
+	return devices, err
+}
+
+// Snapshots returns the snapshots of a device taken in [from, to), oldest first.
+func (s *Store) Snapshots(identity string, from, to time.Time) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(identity))
+		if b == nil {
+			return fmt.Errorf("no history for device %s", identity)
+		}
+		c := b.Cursor()
+		end := timeKey(to)
+		for k, v := c.Seek(timeKey(from)); k != nil && string(k) < string(end); k, v = c.Next() {
+			snapshot := Snapshot{Time: keyTime(k)}
+			if err := json.Unmarshal(v, &snapshot.Info); err != nil {
+				return err
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+		return nil
+	})
+	return snapshots, err
+}
+
+// AttributeSeries returns the time series of an ATA SMART attribute, identified by name or ID, in [from, to).
+func (s *Store) AttributeSeries(identity, attribute string, from, to time.Time) ([]AttributePoint, error) {
+	snapshots, err := s.Snapshots(identity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.Atoi(attribute)
+	if err != nil {
+		id = -1
+	}
+
+	points := []AttributePoint{}
+	for _, snapshot := range snapshots {
+		for _, e := range snapshot.Info.AtaSmartAttributes.Table {
+			if e.Name != attribute && e.Id != id {
+				continue
+			}
+			points = append(points, AttributePoint{
+				Time:   snapshot.Time,
+				Value:  e.Value,
+				Worst:  e.Worst,
+				Thresh: e.Thresh,
+				Raw:    e.Raw.Value,
+			})
+			break
+		}
+	}
+	return points, nil
+}
+
+// Compact deletes snapshots older than the retention period and thins out snapshots older than CompactAfter to
+// the first one in each CompactResolution window.
+func (s *Store) Compact(now time.Time) error {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			keys := [][]byte{}
+			var lastWindow int64 = -1
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+				t := keyTime(k)
+				age := now.Sub(t)
+				if s.opts.Retention > 0 && age > s.opts.Retention {
+					keys = append(keys, append([]byte(nil), k...))
+					continue
+				}
+				if s.opts.CompactAfter <= 0 || s.opts.CompactResolution <= 0 || age <= s.opts.CompactAfter {
+					continue
+				}
+				window := t.UnixNano() / int64(s.opts.CompactResolution)
+				if window == lastWindow {
+					keys = append(keys, append([]byte(nil), k...))
+					continue
+				}
+				lastWindow = window
+			}
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			deleted += len(keys)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.Debug().Int("deleted", deleted).Msg("compacted history")
+	return nil
+}
+
+// RunCompaction compacts the store every interval until ctx is cancelled. It returns immediately if interval isn't
+// positive.
+func (s *Store) RunCompaction(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.Compact(time.Now()); err != nil {
+				s.logger.Error().Err(err).Msg("failed to compact history")
+			}
+		}
+	}
+}
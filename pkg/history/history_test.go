@@ -0,0 +1,71 @@
+package history
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+)
+
+func TestCompact(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "history.db"), Options{
+		Retention:         30 * 24 * time.Hour,
+		CompactAfter:      24 * time.Hour,
+		CompactResolution: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Date(2022, 6, 30, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+	times := []time.Time{
+		// past retention
+		now.Add(-40 * 24 * time.Hour),
+		now.Add(-31 * 24 * time.Hour),
+		// past CompactAfter, thinned to the first point in each hour
+		old,
+		old.Add(10 * time.Minute),
+		old.Add(50 * time.Minute),
+		old.Add(70 * time.Minute),
+		old.Add(80 * time.Minute),
+		old.Add(3 * time.Hour),
+		// recent, kept at full resolution
+		now.Add(-time.Hour),
+		now.Add(-50 * time.Minute),
+		now.Add(-40 * time.Minute),
+	}
+	info := smartctl.InfoAllOutput{Device: smartctl.Device{Name: "/dev/sda"}}
+	for _, ts := range times {
+		if err := s.Put(info, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Compact(now); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := s.Snapshots(info.Identity(), now.Add(-365*24*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []time.Time{}
+	for _, snapshot := range snapshots {
+		got = append(got, snapshot.Time.UTC())
+	}
+	want := []time.Time{
+		old,
+		old.Add(70 * time.Minute),
+		old.Add(3 * time.Hour),
+		now.Add(-time.Hour),
+		now.Add(-50 * time.Minute),
+		now.Add(-40 * time.Minute),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got snapshots at %v, want %v", got, want)
+	}
+}
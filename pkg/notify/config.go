@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/config"
+	"os"
+	"time"
+)
+
+type SinkType string
+
+const (
+	SinkTypeJSON         SinkType = "json"
+	SinkTypeSlack        SinkType = "slack"
+	SinkTypeAlertmanager SinkType = "alertmanager"
+)
+
+type SinkConfig struct {
+	Name string   `json:"name"`
+	Type SinkType `json:"type"`
+	// URL is the webhook URL, or the Alertmanager base URL for alertmanager sinks.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Template is a text/template rendered with a Notification. It replaces the whole body for json sinks, the
+	// message text for slack sinks and the summary annotation for alertmanager sinks.
+	Template string `json:"template"`
+}
+
+type Config struct {
+	Sinks []SinkConfig `json:"sinks"`
+	// DedupInterval suppresses repeated notifications of the same condition on the same device to one per interval.
+	DedupInterval  config.Duration `json:"dedup_interval"`
+	MaxRetries     int             `json:"max_retries"`
+	InitialBackoff config.Duration `json:"initial_backoff"`
+	MaxBackoff     config.Duration `json:"max_backoff"`
+	Timeout        config.Duration `json:"timeout"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{
+		DedupInterval:  config.Duration(time.Hour),
+		MaxRetries:     5,
+		InitialBackoff: config.Duration(time.Second),
+		MaxBackoff:     config.Duration(time.Minute),
+		Timeout:        config.Duration(10 * time.Second),
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	names := map[string]bool{}
+	for _, s := range cfg.Sinks {
+		// names key deduplication and label the delivery failure metric
+		if s.Name == "" {
+			return nil, fmt.Errorf("sink with url %q has no name", s.URL)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("sink name %q is used more than once", s.Name)
+		}
+		names[s.Name] = true
+		switch s.Type {
+		case SinkTypeJSON, SinkTypeSlack, SinkTypeAlertmanager:
+		default:
+			return nil, fmt.Errorf("sink %q has unknown type %q", s.Name, s.Type)
+		}
+		if s.URL == "" {
+			return nil, fmt.Errorf("sink %q has no url", s.Name)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"context"
+	"github.com/milesbxf/smartmon-exporter/pkg/events"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// Notification describes a device health transition.
+type Notification struct {
+	Time      time.Time `json:"time"`
+	Device    string    `json:"device"`
+	Identity  string    `json:"identity"`
+	Condition string    `json:"condition"`
+	Summary   string    `json:"summary"`
+	// Initial marks a condition which already held when the device was first polled.
+	Initial bool `json:"initial,omitempty"`
+}
+
+// transitions maps the health attributes of change events to the value that triggers a notification.
+var transitions = map[string]struct {
+	value   int64
+	summary string
+}{
+	"smart_status_passed":     {0, "SMART overall health self-assessment failed"},
+	"disk_failing":            {1, "SMART reports the disk is failing"},
+	"prefail_above_threshold": {1, "prefailure attributes are above threshold"},
+}
+
+func notificationFromEvent(e events.Event) (Notification, bool) {
+	t, ok := transitions[e.Attribute]
+	if !ok || e.New != t.value {
+		return Notification{}, false
+	}
+	return Notification{
+		Time:      e.Time,
+		Device:    e.Device,
+		Identity:  e.Identity,
+		Condition: e.Attribute,
+		Summary:   t.summary,
+		Initial:   e.Initial,
+	}, true
+}
+
+type dedupKey struct {
+	sink      string
+	identity  string
+	condition string
+}
+
+type Notifier struct {
+	cfg      Config
+	sinks    []*sink
+	logger   zerolog.Logger
+	failures *prometheus.CounterVec
+	sent     map[dedupKey]time.Time
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+func New(cfg Config) (*Notifier, error) {
+	sinks := []*sink{}
+	for _, c := range cfg.Sinks {
+		s, err := newSink(c, time.Duration(cfg.Timeout))
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return &Notifier{
+		cfg:    cfg,
+		sinks:  sinks,
+		logger: log.With().Str("component", "notify").Logger(),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "smart_notification_delivery_failures_total",
+			Help: "Number of notifications which could not be delivered after all retries",
+		}, []string{"sink"}),
+		sent: map[dedupKey]time.Time{},
+	}, nil
+}
+
+func (n *Notifier) Describe(descs chan<- *prometheus.Desc) {
+	n.failures.Describe(descs)
+}
+
+func (n *Notifier) Collect(metrics chan<- prometheus.Metric) {
+	n.failures.Collect(metrics)
+}
+
+// Run sends notifications for health transitions received on ch until it is closed. Failed deliveries are retried
+// until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context, ch <-chan events.Event) {
+	for e := range ch {
+		notification, ok := notificationFromEvent(e)
+		if !ok {
+			continue
+		}
+		for _, s := range n.sinks {
+			if n.duplicate(s, notification) {
+				n.logger.Debug().
+					Str("sink", s.Name).
+					Str("device", notification.Device).
+					Str("condition", notification.Condition).
+					Msg("suppressing duplicate notification")
+				continue
+			}
+			n.wg.Add(1)
+			go func(s *sink) {
+				defer n.wg.Done()
+				n.deliver(ctx, s, notification)
+			}(s)
+		}
+	}
+}
+
+// Wait blocks until all in-flight deliveries have completed.
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+func (n *Notifier) duplicate(s *sink, notification Notification) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	k := dedupKey{sink: s.Name, identity: notification.Identity, condition: notification.Condition}
+	if last, ok := n.sent[k]; ok && notification.Time.Sub(last) < time.Duration(n.cfg.DedupInterval) {
+		return true
+	}
+	n.sent[k] = notification.Time
+	return false
+}
+
+func (n *Notifier) deliver(ctx context.Context, s *sink, notification Notification) {
+	backoff := time.Duration(n.cfg.InitialBackoff)
+	for attempt := 0; ; attempt++ {
+		err := s.send(notification)
+		if err == nil {
+			n.logger.Info().
+				Str("sink", s.Name).
+				Str("device", notification.Device).
+				Str("condition", notification.Condition).
+				Msg("sent notification")
+			return
+		}
+		if attempt >= n.cfg.MaxRetries {
+			n.logger.Error().Err(err).Str("sink", s.Name).Msg("failed to deliver notification")
+			n.failures.WithLabelValues(s.Name).Inc()
+			return
+		}
+		n.logger.Warn().Err(err).Str("sink", s.Name).Dur("backoff", backoff).Msg("retrying notification")
+		select {
+		case <-ctx.Done():
+			n.logger.Error().Err(err).Str("sink", s.Name).Msg("failed to deliver notification, giving up on shutdown")
+			n.failures.WithLabelValues(s.Name).Inc()
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if max := time.Duration(n.cfg.MaxBackoff); max > 0 && backoff > max {
+			backoff = max
+		}
+	}
+}
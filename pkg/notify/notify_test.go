@@ -0,0 +1,310 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/config"
+	"github.com/milesbxf/smartmon-exporter/pkg/events"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type request struct {
+	path string
+	body []byte
+}
+
+// receiver is a local stand-in for a webhook endpoint, failing the first failures requests.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []request
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, request{path: req.URL.Path, body: body})
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *receiver) received() []request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]request{}, r.requests...)
+}
+
+func testConfig(url string, t SinkType) Config {
+	return Config{
+		Sinks:          []SinkConfig{{Name: "test", Type: t, URL: url}},
+		DedupInterval:  config.Duration(time.Hour),
+		MaxRetries:     3,
+		InitialBackoff: config.Duration(time.Millisecond),
+		MaxBackoff:     config.Duration(10 * time.Millisecond),
+		Timeout:        config.Duration(time.Second),
+	}
+}
+
+var failingEvent = events.Event{
+	Time:      time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+	Device:    "/dev/sda",
+	Identity:  "ST16000NM001G-2KK103_ZL2XXXXX",
+	Attribute: "smart_status_passed",
+	Old:       1,
+	New:       0,
+	Delta:     -1,
+}
+
+// run delivers notifications for evs and waits for all deliveries to complete.
+func run(ctx context.Context, n *Notifier, evs ...events.Event) {
+	ch := make(chan events.Event, len(evs))
+	for _, e := range evs {
+		ch <- e
+	}
+	close(ch)
+	n.Run(ctx, ch)
+	n.Wait()
+}
+
+func newNotifier(t *testing.T, cfg Config) *Notifier {
+	t.Helper()
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSinks(t *testing.T) {
+	tests := []struct {
+		sinkType SinkType
+		path     string
+		check    func(t *testing.T, body []byte)
+	}{
+		{SinkTypeJSON, "/hook", func(t *testing.T, body []byte) {
+			n := Notification{}
+			if err := json.Unmarshal(body, &n); err != nil {
+				t.Fatal(err)
+			}
+			if n.Device != "/dev/sda" || n.Condition != "smart_status_passed" || n.Summary == "" {
+				t.Errorf("unexpected notification %+v", n)
+			}
+		}},
+		{SinkTypeSlack, "/hook", func(t *testing.T, body []byte) {
+			msg := map[string]string{}
+			if err := json.Unmarshal(body, &msg); err != nil {
+				t.Fatal(err)
+			}
+			want := "Device /dev/sda (ST16000NM001G-2KK103_ZL2XXXXX): SMART overall health self-assessment failed"
+			if msg["text"] != want {
+				t.Errorf("got text %q, want %q", msg["text"], want)
+			}
+		}},
+		{SinkTypeAlertmanager, "/hook/api/v2/alerts", func(t *testing.T, body []byte) {
+			alerts := []alertmanagerAlert{}
+			if err := json.Unmarshal(body, &alerts); err != nil {
+				t.Fatal(err)
+			}
+			if len(alerts) != 1 {
+				t.Fatalf("got %d alerts, want 1", len(alerts))
+			}
+			if alerts[0].Labels["condition"] != "smart_status_passed" || alerts[0].Labels["device"] != "/dev/sda" {
+				t.Errorf("unexpected labels %v", alerts[0].Labels)
+			}
+			if !alerts[0].StartsAt.Equal(failingEvent.Time) {
+				t.Errorf("got startsAt %s, want %s", alerts[0].StartsAt, failingEvent.Time)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.sinkType), func(t *testing.T) {
+			r := &receiver{}
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			run(context.Background(), newNotifier(t, testConfig(srv.URL+"/hook", tt.sinkType)), failingEvent)
+
+			reqs := r.received()
+			if len(reqs) != 1 {
+				t.Fatalf("got %d requests, want 1", len(reqs))
+			}
+			if reqs[0].path != tt.path {
+				t.Errorf("got path %s, want %s", reqs[0].path, tt.path)
+			}
+			tt.check(t, reqs[0].body)
+		})
+	}
+}
+
+func TestIgnoresNonTransitions(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	recovered := failingEvent
+	recovered.Old, recovered.New, recovered.Delta = 0, 1, 1
+	attribute := failingEvent
+	attribute.Attribute = "Reallocated_Sector_Ct"
+	healthy := events.Event{Device: "/dev/sdb", Attribute: "smart_status_passed", Old: 1, New: 1, Initial: true}
+	run(context.Background(), newNotifier(t, testConfig(srv.URL, SinkTypeJSON)), recovered, attribute, healthy)
+
+	if reqs := r.received(); len(reqs) != 0 {
+		t.Errorf("got %d requests, want 0", len(reqs))
+	}
+}
+
+func TestInitialState(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	initial := events.Event{
+		Device:    "/dev/sda",
+		Attribute: "disk_failing",
+		Old:       1,
+		New:       1,
+		Initial:   true,
+	}
+	run(context.Background(), newNotifier(t, testConfig(srv.URL, SinkTypeJSON)), initial)
+
+	reqs := r.received()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	n := Notification{}
+	if err := json.Unmarshal(reqs[0].body, &n); err != nil {
+		t.Fatal(err)
+	}
+	if !n.Initial || n.Condition != "disk_failing" {
+		t.Errorf("unexpected notification %+v", n)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	r := &receiver{failures: 2}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n := newNotifier(t, testConfig(srv.URL, SinkTypeJSON))
+	run(context.Background(), n, failingEvent)
+
+	if reqs := r.received(); len(reqs) != 3 {
+		t.Errorf("got %d requests, want 3", len(reqs))
+	}
+	if v := testutil.ToFloat64(n.failures.WithLabelValues("test")); v != 0 {
+		t.Errorf("got %v delivery failures, want 0", v)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	r := &receiver{failures: 100}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL, SinkTypeJSON)
+	cfg.MaxRetries = 1
+	n := newNotifier(t, cfg)
+	run(context.Background(), n, failingEvent)
+
+	if reqs := r.received(); len(reqs) != 2 {
+		t.Errorf("got %d requests, want 2", len(reqs))
+	}
+	if v := testutil.ToFloat64(n.failures.WithLabelValues("test")); v != 1 {
+		t.Errorf("got %v delivery failures, want 1", v)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	r := &receiver{failures: 100}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL, SinkTypeJSON)
+	cfg.InitialBackoff = config.Duration(time.Hour)
+	cfg.MaxBackoff = config.Duration(time.Hour)
+	n := newNotifier(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		run(ctx, n, failingEvent)
+		close(done)
+	}()
+	// wait for the first attempt, after which delivery backs off for an hour
+	for len(r.received()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery wasn't cancelled")
+	}
+	if v := testutil.ToFloat64(n.failures.WithLabelValues("test")); v != 1 {
+		t.Errorf("got %v delivery failures, want 1", v)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	again := failingEvent
+	again.Time = failingEvent.Time.Add(time.Minute)
+	later := failingEvent
+	later.Time = failingEvent.Time.Add(2 * time.Hour)
+	run(context.Background(), newNotifier(t, testConfig(srv.URL, SinkTypeJSON)), failingEvent, again, later)
+
+	if reqs := r.received(); len(reqs) != 2 {
+		t.Errorf("got %d requests, want 2: the repeat within the dedup interval should be suppressed", len(reqs))
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"valid", `{"sinks": [{"name": "a", "type": "json", "url": "http://a"}, {"name": "b", "type": "slack", "url": "http://b"}], "max_backoff": "30s"}`, ""},
+		{"missing name", `{"sinks": [{"type": "json", "url": "http://a"}]}`, "has no name"},
+		{"duplicate name", `{"sinks": [{"name": "a", "type": "json", "url": "http://a"}, {"name": "a", "type": "slack", "url": "http://b"}]}`, "more than once"},
+		{"unknown type", `{"sinks": [{"name": "a", "type": "email", "url": "http://a"}]}`, "unknown type"},
+		{"missing url", `{"sinks": [{"name": "a", "type": "json"}]}`, "no url"},
+		{"invalid duration", `{"sinks": [], "timeout": "soon"}`, "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "notify.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadConfig(path)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultMessageTemplate = `Device {{ .Device }} ({{ .Identity }}): {{ .Summary }}`
+
+type sink struct {
+	SinkConfig
+	template *template.Template
+	client   *http.Client
+}
+
+func newSink(cfg SinkConfig, timeout time.Duration) (*sink, error) {
+	text := cfg.Template
+	if text == "" && cfg.Type != SinkTypeJSON {
+		text = defaultMessageTemplate
+	}
+	s := &sink{
+		SinkConfig: cfg,
+		client:     &http.Client{Timeout: timeout},
+	}
+	if text != "" {
+		t, err := template.New(cfg.Name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("sink %q has invalid template: %w", cfg.Name, err)
+		}
+		s.template = t
+	}
+	return s, nil
+}
+
+func (s *sink) render(n Notification) (string, error) {
+	var buf bytes.Buffer
+	if err := s.template.Execute(&buf, n); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+}
+
+func (s *sink) body(n Notification) ([]byte, error) {
+	switch s.Type {
+	case SinkTypeSlack:
+		text, err := s.render(n)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]string{"text": text})
+	case SinkTypeAlertmanager:
+		summary, err := s.render(n)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal([]alertmanagerAlert{{
+			Labels: map[string]string{
+				"alertname": "SmartDeviceHealthTransition",
+				"condition": n.Condition,
+				"device":    n.Device,
+				"identity":  n.Identity,
+				"severity":  "critical",
+			},
+			Annotations: map[string]string{"summary": summary},
+			StartsAt:    n.Time,
+		}})
+	default:
+		if s.template == nil {
+			return json.Marshal(n)
+		}
+		text, err := s.render(n)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(text), nil
+	}
+}
+
+func (s *sink) url() string {
+	if s.Type == SinkTypeAlertmanager {
+		return strings.TrimSuffix(s.URL, "/") + "/api/v2/alerts"
+	}
+	return s.URL
+}
+
+func (s *sink) send(n Notification) error {
+	body, err := s.body(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resource "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Protocol string
+
+const (
+	ProtocolGRPC Protocol = "grpc"
+	ProtocolHTTP Protocol = "http"
+)
+
+type Config struct {
+	// Endpoint is host:port for gRPC, or the base URL for HTTP, to which /v1/metrics is appended.
+	Endpoint string
+	Protocol Protocol
+	Insecure bool
+	Headers  map[string]string
+	Timeout  time.Duration
+}
+
+// Exporter pushes the metrics gathered from a registry to an OpenTelemetry collector. Metrics with a device label
+// are grouped into one resource per device, carrying the device's identity from smart_device_info as resource
+// attributes.
+type Exporter struct {
+	cfg       Config
+	gatherer  prometheus.Gatherer
+	hostname  string
+	startTime time.Time
+	logger    zerolog.Logger
+	trigger   chan struct{}
+
+	conn   *grpc.ClientConn
+	client collectormetrics.MetricsServiceClient
+	http   *http.Client
+}
+
+func New(cfg Config, gatherer prometheus.Gatherer) (*Exporter, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	e := &Exporter{
+		cfg:       cfg,
+		gatherer:  gatherer,
+		hostname:  hostname,
+		startTime: time.Now(),
+		logger:    log.With().Str("component", "otlp").Logger(),
+		trigger:   make(chan struct{}, 1),
+	}
+
+	switch cfg.Protocol {
+	case ProtocolGRPC:
+		creds := credentials.NewTLS(&tls.Config{})
+		if cfg.Insecure {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.Dial(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, err
+		}
+		e.conn = conn
+		e.client = collectormetrics.NewMetricsServiceClient(conn)
+	case ProtocolHTTP:
+		e.http = &http.Client{Timeout: cfg.Timeout}
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q", cfg.Protocol)
+	}
+	return e, nil
+}
+
+func (e *Exporter) Close() error {
+	if e.conn != nil {
+		return e.conn.Close()
+	}
+	return nil
+}
+
+// Trigger requests an export without blocking. Triggers received while an export is in progress are coalesced.
+func (e *Exporter) Trigger() {
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run exports every time the exporter is triggered, until ctx is cancelled. An export in progress is allowed to
+// complete.
+func (e *Exporter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.trigger:
+			exportCtx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+			if err := e.Export(exportCtx); err != nil {
+				e.logger.Error().Err(err).Msg("failed to export metrics")
+			}
+			cancel()
+		}
+	}
+}
+
+func (e *Exporter) Export(ctx context.Context) error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	req := &collectormetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: e.convert(families, time.Now()),
+	}
+
+	if e.client != nil {
+		if len(e.cfg.Headers) > 0 {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.New(e.cfg.Headers))
+		}
+		_, err := e.client.Export(ctx, req)
+		return err
+	}
+
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.cfg.Endpoint, "/")+"/v1/metrics", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	resp, err := e.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func stringAttribute(k, v string) *common.KeyValue {
+	return &common.KeyValue{
+		Key:   k,
+		Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v}},
+	}
+}
+
+type deviceIdentity struct {
+	model  string
+	serial string
+}
+
+// identities returns the model and serial number of each device from the labels of smart_device_info.
+func identities(families []*dto.MetricFamily) map[string]deviceIdentity {
+	ids := map[string]deviceIdentity{}
+	for _, f := range families {
+		if f.GetName() != collector.MetricDeviceInfo {
+			continue
+		}
+		for _, m := range f.Metric {
+			labels := map[string]string{}
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			ids[labels["device"]] = deviceIdentity{model: labels["model_name"], serial: labels["serial_number"]}
+		}
+	}
+	return ids
+}
+
+func (e *Exporter) resource(device string, id deviceIdentity) *resource.Resource {
+	attrs := []*common.KeyValue{
+		stringAttribute("service.name", "smartmon-exporter"),
+		stringAttribute("host.name", e.hostname),
+	}
+	if device != "" {
+		attrs = append(attrs,
+			stringAttribute("hw.name", device),
+			stringAttribute("hw.model", id.model),
+			stringAttribute("hw.serial_number", id.serial),
+		)
+	}
+	return &resource.Resource{Attributes: attrs}
+}
+
+func (e *Exporter) convert(families []*dto.MetricFamily, now time.Time) []*metrics.ResourceMetrics {
+	ids := identities(families)
+	// metrics by device, then by name, so each device's resource gets one Metric per family
+	byDevice := map[string]map[string]*metrics.Metric{}
+
+	for _, f := range families {
+		for _, m := range f.Metric {
+			device := ""
+			attrs := []*common.KeyValue{}
+			for _, l := range m.Label {
+				if l.GetName() == "device" {
+					device = l.GetValue()
+					continue
+				}
+				attrs = append(attrs, stringAttribute(l.GetName(), l.GetValue()))
+			}
+
+			var value float64
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = m.GetUntyped().GetValue()
+			default:
+				continue
+			}
+			point := &metrics.NumberDataPoint{
+				Attributes:   attrs,
+				TimeUnixNano: uint64(now.UnixNano()),
+				Value:        &metrics.NumberDataPoint_AsDouble{AsDouble: value},
+			}
+
+			if byDevice[device] == nil {
+				byDevice[device] = map[string]*metrics.Metric{}
+			}
+			metric, ok := byDevice[device][f.GetName()]
+			if !ok {
+				metric = &metrics.Metric{Name: f.GetName(), Description: f.GetHelp()}
+				if f.GetType() == dto.MetricType_COUNTER {
+					metric.Data = &metrics.Metric_Sum{Sum: &metrics.Sum{
+						AggregationTemporality: metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+						IsMonotonic:            true,
+					}}
+				} else {
+					metric.Data = &metrics.Metric_Gauge{Gauge: &metrics.Gauge{}}
+				}
+				byDevice[device][f.GetName()] = metric
+			}
+			switch d := metric.Data.(type) {
+			case *metrics.Metric_Sum:
+				point.StartTimeUnixNano = uint64(e.startTime.UnixNano())
+				d.Sum.DataPoints = append(d.Sum.DataPoints, point)
+			case *metrics.Metric_Gauge:
+				d.Gauge.DataPoints = append(d.Gauge.DataPoints, point)
+			}
+		}
+	}
+
+	devices := []string{}
+	for d := range byDevice {
+		devices = append(devices, d)
+	}
+	sort.Strings(devices)
+
+	rms := []*metrics.ResourceMetrics{}
+	for _, d := range devices {
+		ms := []*metrics.Metric{}
+		for _, m := range byDevice[d] {
+			ms = append(ms, m)
+		}
+		sort.Slice(ms, func(i, j int) bool { return ms[i].Name < ms[j].Name })
+		rms = append(rms, &metrics.ResourceMetrics{
+			Resource: e.resource(d, ids[d]),
+			ScopeMetrics: []*metrics.ScopeMetrics{{
+				Scope:   &common.InstrumentationScope{Name: "github.com/milesbxf/smartmon-exporter"},
+				Metrics: ms,
+			}},
+		})
+	}
+	return rms
+}
@@ -0,0 +1,202 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+func testRegistry(t *testing.T) *prometheus.Registry {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	info := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: collector.MetricDeviceInfo, Help: "Information about the device"},
+		[]string{"device", "model_family", "model_name", "serial_number", "firmware_version"})
+	info.WithLabelValues("/dev/sda", "Seagate Exos X16", "ST16000NM001G-2KK103", "ZL2XXXXX", "SN03").Set(1)
+	temperature := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: collector.MetricTemperature, Help: "Temperature"},
+		[]string{"device"})
+	temperature.WithLabelValues("/dev/sda").Set(31)
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "smart_poll_failures_total", Help: "Poll failures"},
+		[]string{"reason"})
+	failures.WithLabelValues("scan").Add(2)
+	reg.MustRegister(info, temperature, failures)
+	return reg
+}
+
+func attributes(r *metrics.ResourceMetrics) map[string]string {
+	attrs := map[string]string{}
+	for _, kv := range r.Resource.Attributes {
+		attrs[kv.Key] = kv.Value.GetStringValue()
+	}
+	return attrs
+}
+
+func findMetric(r *metrics.ResourceMetrics, name string) *metrics.Metric {
+	for _, m := range r.ScopeMetrics[0].Metrics {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// checkRequest checks that req groups the metrics of testRegistry into a host resource and a device resource.
+func checkRequest(t *testing.T, req *collectormetrics.ExportMetricsServiceRequest) {
+	t.Helper()
+	rms := req.ResourceMetrics
+	if len(rms) != 2 {
+		t.Fatalf("got %d resources, want 2", len(rms))
+	}
+
+	host, device := rms[0], rms[1]
+	if _, ok := attributes(host)["hw.name"]; ok {
+		t.Errorf("host resource has device attributes: %v", attributes(host))
+	}
+	m := findMetric(host, "smart_poll_failures_total")
+	if m == nil || m.GetSum() == nil || !m.GetSum().IsMonotonic {
+		t.Fatalf("got %v, want a monotonic sum for smart_poll_failures_total", m)
+	}
+	if v := m.GetSum().DataPoints[0].GetAsDouble(); v != 2 {
+		t.Errorf("got smart_poll_failures_total %v, want 2", v)
+	}
+
+	attrs := attributes(device)
+	want := map[string]string{
+		"service.name":     "smartmon-exporter",
+		"hw.name":          "/dev/sda",
+		"hw.model":         "ST16000NM001G-2KK103",
+		"hw.serial_number": "ZL2XXXXX",
+	}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Errorf("got device resource attribute %s=%q, want %q", k, attrs[k], v)
+		}
+	}
+	m = findMetric(device, collector.MetricTemperature)
+	if m == nil || m.GetGauge() == nil {
+		t.Fatalf("got %v, want a gauge for %s", m, collector.MetricTemperature)
+	}
+	if v := m.GetGauge().DataPoints[0].GetAsDouble(); v != 31 {
+		t.Errorf("got %s %v, want 31", collector.MetricTemperature, v)
+	}
+}
+
+type receiver struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+	mu       sync.Mutex
+	requests []*collectormetrics.ExportMetricsServiceRequest
+	headers  []metadata.MD
+}
+
+func (r *receiver) Export(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.headers = append(r.headers, md)
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func TestExportGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &receiver{}
+	srv := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(srv, r)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	e, err := New(Config{
+		Endpoint: lis.Addr().String(),
+		Protocol: ProtocolGRPC,
+		Insecure: true,
+		Headers:  map[string]string{"x-scope-orgid": "home"},
+		Timeout:  5 * time.Second,
+	}, testRegistry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Export(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(r.requests))
+	}
+	if got := r.headers[0].Get("x-scope-orgid"); len(got) != 1 || got[0] != "home" {
+		t.Errorf("got x-scope-orgid metadata %v, want [home]", got)
+	}
+	checkRequest(t, r.requests[0])
+}
+
+func TestExportHTTP(t *testing.T) {
+	var (
+		path, contentType, org string
+		req                    = &collectormetrics.ExportMetricsServiceRequest{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType, org = r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("X-Scope-OrgID")
+		body, _ := io.ReadAll(r.Body)
+		if err := proto.Unmarshal(body, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	e, err := New(Config{
+		Endpoint: srv.URL + "/",
+		Protocol: ProtocolHTTP,
+		Headers:  map[string]string{"X-Scope-OrgID": "home"},
+		Timeout:  5 * time.Second,
+	}, testRegistry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/metrics" {
+		t.Errorf("got path %s, want /v1/metrics", path)
+	}
+	if contentType != "application/x-protobuf" {
+		t.Errorf("got content type %s, want application/x-protobuf", contentType)
+	}
+	if org != "home" {
+		t.Errorf("got X-Scope-OrgID %q, want home", org)
+	}
+	checkRequest(t, req)
+}
+
+func TestExportHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	e, err := New(Config{Endpoint: srv.URL, Protocol: ProtocolHTTP, Timeout: 5 * time.Second}, testRegistry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Export(context.Background()); err == nil {
+		t.Error("expected an error for a 503 response")
+	}
+}
@@ -0,0 +1,150 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatPrometheus Format = "prometheus"
+	FormatInflux     Format = "influx"
+	FormatJSON       Format = "json"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatPrometheus, FormatInflux, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q", s)
+}
+
+// Write encodes the collected data in the given format. Prometheus output is gathered from gatherer; the other
+// formats are built from the latest device information.
+func Write(w io.Writer, format Format, gatherer prometheus.Gatherer, infos []smartctl.InfoAllOutput, t time.Time) error {
+	switch format {
+	case FormatInflux:
+		return WriteInflux(w, infos, t)
+	case FormatJSON:
+		return WriteJSON(w, infos)
+	default:
+		return WritePrometheus(w, gatherer)
+	}
+}
+
+func WritePrometheus(w io.Writer, gatherer prometheus.Gatherer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	for _, f := range families {
+		if _, err := expfmt.MetricFamilyToText(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func WriteJSON(w io.Writer, infos []smartctl.InfoAllOutput) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(infos)
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type influxField struct {
+	key   string
+	value int64
+}
+
+// WriteInflux writes one smart_device point per device in InfluxDB line protocol, tagged with the device's
+// identity and with a field for each ATA SMART attribute's normalized and raw values.
+func WriteInflux(w io.Writer, infos []smartctl.InfoAllOutput, t time.Time) error {
+	for _, info := range infos {
+		tags := [][2]string{
+			{"device", info.Device.Name},
+			{"firmware_version", info.FirmwareVersion},
+			{"model_family", info.ModelFamily},
+			{"model_name", info.ModelName},
+			{"protocol", info.Device.Protocol},
+			{"serial_number", info.SerialNumber},
+		}
+
+		fields := []influxField{
+			{"smart_status_passed", boolInt(info.SmartStatus.Passed)},
+			{"temperature", int64(info.Temperature.Current)},
+			{"power_on_hours", int64(info.PowerOnTime.Hours)},
+			{"power_cycle_count", int64(info.PowerCycleCount)},
+			{"user_capacity_bytes", info.UserCapacity.Bytes},
+			{"disk_failing", boolInt(info.SmartExitCodeOutput.DiskFailing)},
+			{"prefail_above_threshold", boolInt(info.SmartExitCodeOutput.PrefailAboveThreshold)},
+		}
+		seen := map[string]bool{}
+		for _, e := range info.AtaSmartAttributes.Table {
+			if seen[e.Name] {
+				continue
+			}
+			seen[e.Name] = true
+			fields = append(fields,
+				influxField{e.Name + "_value", int64(e.Value)},
+				influxField{e.Name + "_raw", int64(e.Raw.Value)},
+			)
+		}
+		if info.Device.Protocol == "NVMe" {
+			h := info.NvmeSmartHealthInformationLog
+			fields = append(fields,
+				influxField{"nvme_critical_warning", int64(h.CriticalWarning)},
+				influxField{"nvme_available_spare", int64(h.AvailableSpare)},
+				influxField{"nvme_percentage_used", int64(h.PercentageUsed)},
+				influxField{"nvme_data_units_written", h.DataUnitsWritten},
+				influxField{"nvme_data_units_read", h.DataUnitsRead},
+				influxField{"nvme_media_errors", h.MediaErrors},
+				influxField{"nvme_unsafe_shutdowns", h.UnsafeShutdowns},
+			)
+		}
+		sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+
+		var b strings.Builder
+		b.WriteString(influxMeasurementEscaper.Replace("smart_device"))
+		for _, tag := range tags {
+			if tag[1] == "" {
+				continue
+			}
+			b.WriteString("," + influxKeyEscaper.Replace(tag[0]) + "=" + influxKeyEscaper.Replace(tag[1]))
+		}
+		for i, f := range fields {
+			sep := ","
+			if i == 0 {
+				sep = " "
+			}
+			b.WriteString(sep + influxKeyEscaper.Replace(f.key) + "=" + strconv.FormatInt(f.value, 10) + "i")
+		}
+		b.WriteString(" " + strconv.FormatInt(t.UnixNano(), 10) + "\n")
+
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
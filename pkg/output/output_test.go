@@ -0,0 +1,36 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+)
+
+func TestWriteInflux(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "influx.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []smartctl.InfoAllOutput
+	if err := json.Unmarshal(b, &infos); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := WriteInflux(&out, infos, time.Unix(1654084800, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := os.ReadFile(filepath.Join("testdata", "influx.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package push
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// Target is a destination the collector's metrics are pushed to.
+type Target interface {
+	Name() string
+	Push(ctx context.Context) error
+}
+
+type Options struct {
+	Timeout        time.Duration
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Runner pushes to a target whenever it is triggered, retrying failed pushes with exponential backoff.
+type Runner struct {
+	target  Target
+	opts    Options
+	logger  zerolog.Logger
+	trigger chan struct{}
+}
+
+func NewRunner(target Target, opts Options) *Runner {
+	return &Runner{
+		target:  target,
+		opts:    opts,
+		logger:  log.With().Str("component", "push").Str("target", target.Name()).Logger(),
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Trigger requests a push without blocking. Triggers received while a push is in progress are coalesced.
+func (r *Runner) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run pushes every time the runner is triggered, until ctx is cancelled. A push attempt in progress is allowed to
+// complete, but no further retries are made.
+func (r *Runner) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.trigger:
+			_ = r.Push(ctx)
+		}
+	}
+}
+
+// Push pushes to the target now, retrying like Run, and returns the error of the last attempt.
+func (r *Runner) Push(ctx context.Context) error {
+	backoff := r.opts.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		pushCtx, cancel := context.WithTimeout(context.Background(), r.opts.Timeout)
+		err := r.target.Push(pushCtx)
+		cancel()
+		if err == nil {
+			r.logger.Debug().Msg("pushed metrics")
+			return nil
+		}
+		if attempt >= r.opts.MaxRetries {
+			r.logger.Error().Err(err).Msg("failed to push metrics")
+			return err
+		}
+		r.logger.Warn().Err(err).Dur("backoff", backoff).Msg("retrying push")
+		select {
+		case <-ctx.Done():
+			r.logger.Error().Err(err).Msg("failed to push metrics, giving up on shutdown")
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if r.opts.MaxBackoff > 0 && backoff > r.opts.MaxBackoff {
+			backoff = r.opts.MaxBackoff
+		}
+	}
+}
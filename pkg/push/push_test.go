@@ -0,0 +1,163 @@
+package push
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// flakyServer fails the first failures requests with a 503, and records when each request arrived.
+type flakyServer struct {
+	mu       sync.Mutex
+	failures int
+	times    []time.Time
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.times = append(s.times, time.Now())
+	if len(s.times) <= s.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *flakyServer) requests() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time{}, s.times...)
+}
+
+func TestRunnerRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		maxRetries int
+		requests   int
+		err        string
+	}{
+		{"first attempt succeeds", 0, 3, 1, ""},
+		{"succeeds after retries", 2, 3, 3, ""},
+		{"gives up", 10, 2, 3, "503"},
+		{"no retries", 10, 0, 1, "503"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &flakyServer{failures: tt.failures}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			r := NewRunner(NewRemoteWrite(srv.URL, nil, prometheus.NewRegistry()), Options{
+				Timeout:        time.Second,
+				MaxRetries:     tt.maxRetries,
+				InitialBackoff: 10 * time.Millisecond,
+			})
+			err := r.Push(context.Background())
+			if tt.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+
+			times := s.requests()
+			if len(times) != tt.requests {
+				t.Fatalf("got %d requests, want %d", len(times), tt.requests)
+			}
+			// the backoff doubles after each failed attempt
+			backoff := 10 * time.Millisecond
+			for i := 1; i < len(times); i++ {
+				if gap := times[i].Sub(times[i-1]); gap < backoff {
+					t.Errorf("retry %d after %s, want at least %s", i, gap, backoff)
+				}
+				backoff *= 2
+			}
+		})
+	}
+}
+
+func TestRunnerMaxBackoff(t *testing.T) {
+	s := &flakyServer{failures: 3}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	r := NewRunner(NewRemoteWrite(srv.URL, nil, prometheus.NewRegistry()), Options{
+		Timeout:        time.Second,
+		MaxRetries:     3,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     30 * time.Millisecond,
+	})
+	start := time.Now()
+	if err := r.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// uncapped, the backoffs would total 140ms
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed >= 140*time.Millisecond {
+		t.Errorf("retries took %s, want backoffs of 20ms, 30ms and 30ms", elapsed)
+	}
+}
+
+func TestRunnerGivesUpOnShutdown(t *testing.T) {
+	s := &flakyServer{failures: 10}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	r := NewRunner(NewRemoteWrite(srv.URL, nil, prometheus.NewRegistry()), Options{
+		Timeout:        time.Second,
+		MaxRetries:     10,
+		InitialBackoff: time.Hour,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for len(s.requests()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if err := r.Push(ctx); err == nil {
+		t.Error("expected the failed push's error")
+	}
+	if got := len(s.requests()); got != 1 {
+		t.Errorf("got %d requests, want no retries after shutdown", got)
+	}
+}
+
+func TestRunnerTriggersCoalesce(t *testing.T) {
+	s := &flakyServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	r := NewRunner(NewRemoteWrite(srv.URL, nil, prometheus.NewRegistry()), Options{Timeout: time.Second})
+	for i := 0; i < 5; i++ {
+		r.Trigger()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	for len(s.requests()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if got := len(s.requests()); got != 1 {
+		t.Errorf("got %d pushes, want triggers before the run to be coalesced into 1", got)
+	}
+}
@@ -0,0 +1,37 @@
+package push
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"net/http"
+	"time"
+)
+
+// Pushgateway replaces the metrics in the exporter's group on a Pushgateway, grouped by job and instance.
+type Pushgateway struct {
+	pusher *push.Pusher
+}
+
+func NewPushgateway(url, job, instance string, gatherer prometheus.Gatherer, timeout time.Duration) *Pushgateway {
+	return &Pushgateway{
+		pusher: push.New(url, job).
+			Gatherer(gatherer).
+			Grouping("instance", instance).
+			Client(&http.Client{Timeout: timeout}),
+	}
+}
+
+func (p *Pushgateway) Name() string {
+	return "pushgateway"
+}
+
+// Push ignores ctx as the pusher doesn't support contexts; requests are bounded by the client timeout instead.
+func (p *Pushgateway) Push(_ context.Context) error {
+	return p.pusher.Push()
+}
+
+// Delete removes the exporter's group from the Pushgateway, so its metrics don't outlive it.
+func (p *Pushgateway) Delete() error {
+	return p.pusher.Delete()
+}
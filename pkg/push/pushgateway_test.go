@@ -0,0 +1,35 @@
+package push
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPushgatewayDelete(t *testing.T) {
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	pg := NewPushgateway(srv.URL, "smartmon", "host", testRegistry(), time.Second)
+	if err := pg.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"PUT /metrics/job/smartmon/instance/host",
+		"DELETE /metrics/job/smartmon/instance/host",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("got requests %v, want %v", requests, want)
+	}
+}
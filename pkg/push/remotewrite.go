@@ -0,0 +1,129 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// RemoteWrite sends the gathered metrics to a Prometheus remote-write endpoint.
+type RemoteWrite struct {
+	url            string
+	gatherer       prometheus.Gatherer
+	externalLabels map[string]string
+	client         *http.Client
+}
+
+func NewRemoteWrite(url string, externalLabels map[string]string, gatherer prometheus.Gatherer) *RemoteWrite {
+	return &RemoteWrite{
+		url:            url,
+		gatherer:       gatherer,
+		externalLabels: externalLabels,
+		client:         &http.Client{},
+	}
+}
+
+func (r *RemoteWrite) Name() string {
+	return "remote-write"
+}
+
+func (r *RemoteWrite) Push(ctx context.Context) error {
+	families, err := r.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, r.encode(families, time.Now()))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+func sampleValue(t dto.MetricType, m *dto.Metric) (float64, bool) {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return m.GetCounter().GetValue(), true
+	case dto.MetricType_GAUGE:
+		return m.GetGauge().GetValue(), true
+	case dto.MetricType_UNTYPED:
+		return m.GetUntyped().GetValue(), true
+	}
+	return math.NaN(), false
+}
+
+// encode builds a prometheus.WriteRequest protobuf message. Only the fields needed here are encoded:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func (r *RemoteWrite) encode(families []*dto.MetricFamily, now time.Time) []byte {
+	var req []byte
+	for _, f := range families {
+		for _, m := range f.Metric {
+			v, ok := sampleValue(f.GetType(), m)
+			if !ok {
+				continue
+			}
+
+			labels := []label{{name: "__name__", value: f.GetName()}}
+			for _, l := range m.Label {
+				labels = append(labels, label{name: l.GetName(), value: l.GetValue()})
+			}
+			for k, v := range r.externalLabels {
+				labels = append(labels, label{name: k, value: v})
+			}
+			sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+			var ts []byte
+			for _, l := range labels {
+				var lb []byte
+				lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+				lb = protowire.AppendString(lb, l.name)
+				lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+				lb = protowire.AppendString(lb, l.value)
+				ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+				ts = protowire.AppendBytes(ts, lb)
+			}
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(v))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(now.UnixNano()/int64(time.Millisecond)))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sample)
+
+			req = protowire.AppendTag(req, 1, protowire.BytesType)
+			req = protowire.AppendBytes(req, ts)
+		}
+	}
+	return req
+}
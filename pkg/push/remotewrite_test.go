@@ -0,0 +1,188 @@
+package push
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+type series struct {
+	labels  map[string]string
+	samples []sample
+}
+
+// fields splits a protobuf message into its fields, failing the test if it's malformed.
+func fields(t *testing.T, b []byte, each func(num protowire.Number, typ protowire.Type, v []byte)) {
+	t.Helper()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		m := protowire.ConsumeFieldValue(num, typ, b)
+		if m < 0 {
+			t.Fatal(protowire.ParseError(m))
+		}
+		each(num, typ, b[:m])
+		b = b[m:]
+	}
+}
+
+func decodeBytes(t *testing.T, v []byte) []byte {
+	t.Helper()
+	b, n := protowire.ConsumeBytes(v)
+	if n < 0 {
+		t.Fatal(protowire.ParseError(n))
+	}
+	return b
+}
+
+// decodeWriteRequest decodes the fields of a prometheus.WriteRequest which encode writes.
+func decodeWriteRequest(t *testing.T, b []byte) []series {
+	t.Helper()
+	all := []series{}
+	fields(t, b, func(num protowire.Number, _ protowire.Type, v []byte) {
+		if num != 1 {
+			t.Fatalf("unexpected WriteRequest field %d", num)
+		}
+		s := series{labels: map[string]string{}}
+		fields(t, decodeBytes(t, v), func(num protowire.Number, _ protowire.Type, v []byte) {
+			switch num {
+			case 1:
+				var name, value string
+				fields(t, decodeBytes(t, v), func(num protowire.Number, _ protowire.Type, v []byte) {
+					if num == 1 {
+						name = string(decodeBytes(t, v))
+					} else {
+						value = string(decodeBytes(t, v))
+					}
+				})
+				s.labels[name] = value
+			case 2:
+				var smp sample
+				fields(t, decodeBytes(t, v), func(num protowire.Number, _ protowire.Type, v []byte) {
+					if num == 1 {
+						bits, _ := protowire.ConsumeFixed64(v)
+						smp.value = math.Float64frombits(bits)
+					} else {
+						ts, _ := protowire.ConsumeVarint(v)
+						smp.timestamp = int64(ts)
+					}
+				})
+				s.samples = append(s.samples, smp)
+			default:
+				t.Fatalf("unexpected TimeSeries field %d", num)
+			}
+		})
+		all = append(all, s)
+	})
+	return all
+}
+
+func testRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	temperature := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "smart_temperature_celsius",
+		Help: "Temperature",
+	}, []string{"device"})
+	temperature.WithLabelValues("/dev/sda").Set(35)
+	temperature.WithLabelValues("/dev/sdb").Set(-1.5)
+	polls := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "smart_polls_total",
+		Help: "Polls",
+	})
+	polls.Add(3)
+	// histograms have no single sample value, so aren't written
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "smart_poll_duration_seconds",
+		Help: "Poll duration",
+	})
+	duration.Observe(1)
+	reg.MustRegister(temperature, polls, duration)
+	return reg
+}
+
+func TestRemoteWriteEncode(t *testing.T) {
+	reg := testRegistry()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	rw := NewRemoteWrite("http://localhost", map[string]string{"job": "smartmon", "instance": "host"}, reg)
+
+	got := decodeWriteRequest(t, rw.encode(families, now))
+	ts := now.UnixNano() / int64(time.Millisecond)
+	want := []series{
+		{
+			labels:  map[string]string{"__name__": "smart_polls_total", "job": "smartmon", "instance": "host"},
+			samples: []sample{{3, ts}},
+		},
+		{
+			labels: map[string]string{
+				"__name__": "smart_temperature_celsius", "device": "/dev/sda", "job": "smartmon", "instance": "host",
+			},
+			samples: []sample{{35, ts}},
+		},
+		{
+			labels: map[string]string{
+				"__name__": "smart_temperature_celsius", "device": "/dev/sdb", "job": "smartmon", "instance": "host",
+			},
+			samples: []sample{{-1.5, ts}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestRemoteWritePush(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	if err := NewRemoteWrite(srv.URL, nil, testRegistry()).Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().UnixNano() / int64(time.Millisecond)
+
+	b, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := decodeWriteRequest(t, b)
+
+	if len(got) != 3 {
+		t.Fatalf("got %d series, want 3", len(got))
+	}
+	for _, s := range got {
+		if len(s.samples) != 1 || s.samples[0].timestamp < before || s.samples[0].timestamp > after {
+			t.Errorf("got samples %+v, want one timestamped between %d and %d", s.samples, before, after)
+		}
+	}
+}
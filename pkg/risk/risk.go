@@ -0,0 +1,194 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Factor is a predictive attribute which contributes Weight to the risk score once its value crosses Threshold.
+//
+// Source is "ata:<attribute id>" for the raw value of an ATA SMART attribute (or the first component of its
+// decoded raw value, for vendors which pack several counters into it), or "nvme:<field>" for one of
+// media_errors, critical_warning, available_spare or available_spare_margin (available spare above the
+// device's threshold).
+type Factor struct {
+	Reason    string  `json:"reason"`
+	Source    string  `json:"source"`
+	Weight    float64 `json:"weight"`
+	Threshold float64 `json:"threshold"`
+	// Below triggers the factor when the value is below Threshold rather than above it.
+	Below bool `json:"below"`
+}
+
+type Config struct {
+	Factors []Factor `json:"factors"`
+}
+
+// DefaultConfig follows the attributes Backblaze found most predictive of drive failure.
+func DefaultConfig() Config {
+	return Config{
+		Factors: []Factor{
+			{Reason: "reallocated_sectors", Source: "ata:5", Weight: 0.3},
+			{Reason: "reported_uncorrectable_errors", Source: "ata:187", Weight: 0.35},
+			{Reason: "command_timeouts", Source: "ata:188", Weight: 0.15},
+			{Reason: "pending_sectors", Source: "ata:197", Weight: 0.35},
+			{Reason: "offline_uncorrectable_sectors", Source: "ata:198", Weight: 0.35},
+			{Reason: "media_errors", Source: "nvme:media_errors", Weight: 0.35},
+			{Reason: "critical_warning", Source: "nvme:critical_warning", Weight: 0.5},
+			{Reason: "low_available_spare", Source: "nvme:available_spare_margin", Weight: 0.3, Threshold: 10, Below: true},
+		},
+	}
+}
+
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// validate checks that each factor has a distinct reason, since reasons label the exported factors, a known source
+// and a weight in (0, 1].
+func (c Config) validate() error {
+	reasons := map[string]bool{}
+	for _, f := range c.Factors {
+		if f.Reason == "" {
+			return fmt.Errorf("factor with source %q has no reason", f.Source)
+		}
+		if reasons[f.Reason] {
+			return fmt.Errorf("factor reason %q is used more than once", f.Reason)
+		}
+		reasons[f.Reason] = true
+		if _, err := parseSource(f.Source); err != nil {
+			return fmt.Errorf("factor %q: %w", f.Reason, err)
+		}
+		if f.Weight <= 0 || f.Weight > 1 {
+			return fmt.Errorf("factor %q: weight must be greater than 0 and at most 1", f.Reason)
+		}
+	}
+	return nil
+}
+
+type source func(info smartctl.InfoAllOutput) (float64, bool)
+
+func parseSource(s string) (source, error) {
+	kind, name := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		kind, name = s[:i], s[i+1:]
+	}
+	switch kind {
+	case "ata":
+		id, err := strconv.Atoi(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ATA attribute id in source %q", s)
+		}
+		return ataSource(id), nil
+	case "nvme":
+		if f, ok := nvmeSources[name]; ok {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown source %q", s)
+}
+
+func ataSource(id int) source {
+	return func(info smartctl.InfoAllOutput) (float64, bool) {
+		for _, e := range info.AtaSmartAttributes.Table {
+			if e.Id != id {
+				continue
+			}
+			if components, ok := smartctl.DecodeRaw(info, e); ok && len(components) > 0 {
+				return components[0].Value, true
+			}
+			return float64(e.Raw.Value), true
+		}
+		return 0, false
+	}
+}
+
+func nvmeSource(f func(h smartctl.NvmeSmartHealthInformationLog) float64) source {
+	return func(info smartctl.InfoAllOutput) (float64, bool) {
+		if info.Device.Protocol != "NVMe" {
+			return 0, false
+		}
+		return f(info.NvmeSmartHealthInformationLog), true
+	}
+}
+
+var nvmeSources = map[string]source{
+	"media_errors": nvmeSource(func(h smartctl.NvmeSmartHealthInformationLog) float64 {
+		return float64(h.MediaErrors)
+	}),
+	"critical_warning": nvmeSource(func(h smartctl.NvmeSmartHealthInformationLog) float64 {
+		return float64(h.CriticalWarning)
+	}),
+	"available_spare": nvmeSource(func(h smartctl.NvmeSmartHealthInformationLog) float64 {
+		return float64(h.AvailableSpare)
+	}),
+	"available_spare_margin": nvmeSource(func(h smartctl.NvmeSmartHealthInformationLog) float64 {
+		return float64(h.AvailableSpare - h.AvailableSpareThreshold)
+	}),
+}
+
+type Contribution struct {
+	Reason string
+	Value  float64
+	Weight float64
+}
+
+type Assessment struct {
+	// Score is between 0 and 1, combining the weights w of the triggered factors as 1 - Π(1 - w).
+	Score   float64
+	Factors []Contribution
+}
+
+type Scorer struct {
+	factors []Factor
+	sources []source
+}
+
+func New(cfg Config) (*Scorer, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	s := &Scorer{}
+	for _, f := range cfg.Factors {
+		src, err := parseSource(f.Source)
+		if err != nil {
+			return nil, fmt.Errorf("factor %q: %w", f.Reason, err)
+		}
+		s.factors = append(s.factors, f)
+		s.sources = append(s.sources, src)
+	}
+	return s, nil
+}
+
+func (s *Scorer) Evaluate(info smartctl.InfoAllOutput) Assessment {
+	a := Assessment{Factors: []Contribution{}}
+	healthy := 1.
+	for i, f := range s.factors {
+		v, ok := s.sources[i](info)
+		if !ok {
+			continue
+		}
+		if (f.Below && v >= f.Threshold) || (!f.Below && v <= f.Threshold) {
+			continue
+		}
+		healthy *= 1 - f.Weight
+		a.Factors = append(a.Factors, Contribution{Reason: f.Reason, Value: v, Weight: f.Weight})
+	}
+	a.Score = 1 - healthy
+	return a
+}
@@ -0,0 +1,161 @@
+package risk
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"valid", `{"factors": [{"reason": "a", "source": "ata:5", "weight": 0.3}, {"reason": "b", "source": "nvme:media_errors", "weight": 1}]}`, ""},
+		{"duplicate reason", `{"factors": [{"reason": "a", "source": "ata:5", "weight": 0.3}, {"reason": "a", "source": "ata:197", "weight": 0.3}]}`, "used more than once"},
+		{"missing reason", `{"factors": [{"source": "ata:5", "weight": 0.3}]}`, "has no reason"},
+		{"zero weight", `{"factors": [{"reason": "a", "source": "ata:5", "weight": 0}]}`, "weight"},
+		{"negative weight", `{"factors": [{"reason": "a", "source": "ata:5", "weight": -0.1}]}`, "weight"},
+		{"weight above one", `{"factors": [{"reason": "a", "source": "ata:5", "weight": 1.5}]}`, "weight"},
+		{"unknown source", `{"factors": [{"reason": "a", "source": "scsi:5", "weight": 0.3}]}`, "unknown source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "risk.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadConfig(path)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if _, err := New(DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadInfo(t *testing.T, name string) smartctl.InfoAllOutput {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info smartctl.InfoAllOutput
+	if err := json.Unmarshal(b, &info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		info    string
+		score   float64
+		reasons []string
+	}{
+		{"healthy ATA", DefaultConfig(), "ata_healthy.json", 0, []string{}},
+		{
+			// the Seagate command timeout count is decoded from the packed raw value, so isn't triggered
+			name:    "failing ATA",
+			config:  DefaultConfig(),
+			info:    "ata_failing.json",
+			score:   1 - (1-0.3)*(1-0.35),
+			reasons: []string{"reallocated_sectors", "pending_sectors"},
+		},
+		{"healthy NVMe", DefaultConfig(), "nvme_healthy.json", 0, []string{}},
+		{
+			name:    "failing NVMe",
+			config:  DefaultConfig(),
+			info:    "nvme_failing.json",
+			score:   1 - (1-0.35)*(1-0.5)*(1-0.3),
+			reasons: []string{"media_errors", "critical_warning", "low_available_spare"},
+		},
+		{
+			name:    "ATA factors don't apply to NVMe",
+			config:  Config{Factors: []Factor{{Reason: "reallocated_sectors", Source: "ata:5", Weight: 0.3}}},
+			info:    "nvme_failing.json",
+			reasons: []string{},
+		},
+		{
+			name:    "NVMe factors don't apply to ATA",
+			config:  Config{Factors: []Factor{{Reason: "low_available_spare", Source: "nvme:available_spare", Weight: 0.3, Threshold: 10, Below: true}}},
+			info:    "ata_failing.json",
+			reasons: []string{},
+		},
+		{
+			name:    "at threshold",
+			config:  Config{Factors: []Factor{{Reason: "reallocated_sectors", Source: "ata:5", Weight: 0.3, Threshold: 8}}},
+			info:    "ata_failing.json",
+			reasons: []string{},
+		},
+		{
+			name:    "above threshold",
+			config:  Config{Factors: []Factor{{Reason: "reallocated_sectors", Source: "ata:5", Weight: 0.3, Threshold: 7}}},
+			info:    "ata_failing.json",
+			score:   0.3,
+			reasons: []string{"reallocated_sectors"},
+		},
+		{
+			name:    "at threshold below",
+			config:  Config{Factors: []Factor{{Reason: "low_available_spare", Source: "nvme:available_spare_margin", Weight: 0.3, Threshold: 5, Below: true}}},
+			info:    "nvme_failing.json",
+			reasons: []string{},
+		},
+		{
+			name:    "below threshold",
+			config:  Config{Factors: []Factor{{Reason: "low_available_spare", Source: "nvme:available_spare", Weight: 0.3, Threshold: 20, Below: true}}},
+			info:    "nvme_failing.json",
+			score:   0.3,
+			reasons: []string{"low_available_spare"},
+		},
+		{
+			name: "full weight",
+			config: Config{Factors: []Factor{
+				{Reason: "media_errors", Source: "nvme:media_errors", Weight: 1},
+				{Reason: "critical_warning", Source: "nvme:critical_warning", Weight: 0.5},
+			}},
+			info:    "nvme_failing.json",
+			score:   1,
+			reasons: []string{"media_errors", "critical_warning"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := s.Evaluate(loadInfo(t, tt.info))
+			if math.Abs(a.Score-tt.score) > 1e-9 {
+				t.Errorf("got score %v, want %v", a.Score, tt.score)
+			}
+			reasons := []string{}
+			for _, f := range a.Factors {
+				reasons = append(reasons, f.Reason)
+			}
+			if !reflect.DeepEqual(reasons, tt.reasons) {
+				t.Errorf("got factors %v, want %v", reasons, tt.reasons)
+			}
+		})
+	}
+}
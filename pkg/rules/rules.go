@@ -0,0 +1,143 @@
+package rules
+
+import (
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/collector"
+	"gopkg.in/yaml.v3"
+	"io"
+	"time"
+)
+
+type Config struct {
+	// Job is the Prometheus job label of the exporter's scrape targets.
+	Job string
+	// For is how long a condition must hold before alerts fire.
+	For                   time.Duration
+	TemperatureCelsius    float64
+	LifeUsedPercent       float64
+	LifeRemainingDays     float64
+	FailureRiskScore      float64
+	ReallocationsInWindow time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Job:                   "smartmon",
+		For:                   5 * time.Minute,
+		TemperatureCelsius:    60,
+		LifeUsedPercent:       80,
+		LifeRemainingDays:     90,
+		FailureRiskScore:      0.5,
+		ReallocationsInWindow: 24 * time.Hour,
+	}
+}
+
+type Rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type Group struct {
+	Name  string `yaml:"name"`
+	Rules []Rule `yaml:"rules"`
+}
+
+type File struct {
+	Groups []Group `yaml:"groups"`
+}
+
+// duration formats d in Prometheus' duration syntax, which unlike Go's doesn't allow compound units such as "1h0m0s".
+func duration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "0s"
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+func rule(alert, severity, expr string, forDuration time.Duration, summary string) Rule {
+	r := Rule{
+		Alert:  alert,
+		Expr:   expr,
+		Labels: map[string]string{"severity": severity},
+		Annotations: map[string]string{
+			"summary": summary,
+		},
+	}
+	if forDuration > 0 {
+		r.For = duration(forDuration)
+	}
+	return r
+}
+
+func Generate(cfg Config) File {
+	return File{
+		Groups: []Group{
+			{
+				Name: "smartmon-exporter",
+				Rules: []Rule{
+					rule("SmartDeviceFailing", "critical",
+						fmt.Sprintf("%s == 1 or %s == 0", collector.MetricDiskFailing, collector.MetricSmartStatusPassed),
+						0,
+						"SMART reports device {{ $labels.device }} on {{ $labels.instance }} is failing"),
+					rule("SmartPrefailAboveThreshold", "critical",
+						fmt.Sprintf("%s == 1", collector.MetricPrefailuresAboveThreshold),
+						0,
+						"Prefailure attributes of device {{ $labels.device }} on {{ $labels.instance }} are above threshold"),
+					rule("SmartTemperatureHigh", "warning",
+						fmt.Sprintf("%s > %g", collector.MetricTemperature, cfg.TemperatureCelsius),
+						cfg.For,
+						"Device {{ $labels.device }} on {{ $labels.instance }} is at {{ $value }}°C"),
+					rule("SmartNewReallocatedSectors", "warning",
+						fmt.Sprintf(`increase(%s{attribute="Reallocated_Sector_Ct"}[%s]) > 0`,
+							collector.MetricAttributeChangesTotal, duration(cfg.ReallocationsInWindow)),
+						0,
+						"Reallocated sector count of device {{ $labels.device }} on {{ $labels.instance }} has changed"),
+					rule("SmartFailureRiskHigh", "warning",
+						fmt.Sprintf("%s > %g", collector.MetricFailureRiskScore, cfg.FailureRiskScore),
+						cfg.For,
+						"Device {{ $labels.device }} on {{ $labels.instance }} has a failure risk score of {{ $value }}"),
+					rule("SmartSsdWearHigh", "warning",
+						fmt.Sprintf("%s > %g", collector.MetricLifeUsedPercent, cfg.LifeUsedPercent),
+						cfg.For,
+						"Device {{ $labels.device }} on {{ $labels.instance }} has used {{ $value }}% of its rated endurance"),
+					rule("SmartSsdLifeRemainingLow", "warning",
+						fmt.Sprintf("%s < %g", collector.MetricEstimatedLifeRemainingDays, cfg.LifeRemainingDays),
+						cfg.For,
+						"Device {{ $labels.device }} on {{ $labels.instance }} is estimated to reach its rated endurance in {{ $value }} days"),
+					rule("SmartDeviceCommandFailure", "warning",
+						fmt.Sprintf("%s == 1 or %s == 1", collector.MetricOpenFailure, collector.MetricCommandFailure),
+						cfg.For,
+						"smartctl failed to query device {{ $labels.device }} on {{ $labels.instance }}"),
+					rule("SmartDeviceDown", "warning",
+						fmt.Sprintf("%s == 0", collector.MetricDeviceUp),
+						cfg.For,
+						"Device {{ $labels.device }} on {{ $labels.instance }} could not be polled and its metrics are stale or missing"),
+					rule("SmartExporterScrapeFailing", "warning",
+						fmt.Sprintf(`up{job="%s"} == 0`, cfg.Job),
+						cfg.For,
+						"smartmon-exporter on {{ $labels.instance }} cannot be scraped"),
+				},
+			},
+		},
+	}
+}
+
+func Write(w io.Writer, f File) error {
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(f); err != nil {
+		return err
+	}
+	return e.Close()
+}
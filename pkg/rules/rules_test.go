@@ -0,0 +1,91 @@
+package rules
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{30 * time.Second, "30s"},
+		{90 * time.Second, "90s"},
+		{5 * time.Minute, "5m"},
+		{90 * time.Minute, "90m"},
+		{2 * time.Hour, "2h"},
+		{24 * time.Hour, "1d"},
+		{36 * time.Hour, "36h"},
+		{7 * 24 * time.Hour, "7d"},
+	}
+	for _, tt := range tests {
+		if got := duration(tt.d); got != tt.want {
+			t.Errorf("duration(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+// TestGenerate checks the default rules against testdata/rules.yml, which testdata/rules_test.yml unit tests with
+// promtool. Regenerate it with `smartmon-exporter rules > pkg/rules/testdata/rules.yml` after changing the rules.
+func TestGenerate(t *testing.T) {
+	want, err := os.ReadFile("testdata/rules.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &bytes.Buffer{}
+	if err := Write(got, Generate(DefaultConfig())); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("generated rules differ from testdata/rules.yml:\n%s", got)
+	}
+}
+
+// TestRuleTestsCoverAlerts checks that every generated alert has a promtool unit test.
+func TestRuleTestsCoverAlerts(t *testing.T) {
+	b, err := os.ReadFile("testdata/rules_test.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := struct {
+		Tests []struct {
+			AlertRuleTest []struct {
+				Alertname string `yaml:"alertname"`
+			} `yaml:"alert_rule_test"`
+		} `yaml:"tests"`
+	}{}
+	if err := yaml.Unmarshal(b, &tests); err != nil {
+		t.Fatal(err)
+	}
+	tested := map[string]bool{}
+	for _, test := range tests.Tests {
+		for _, a := range test.AlertRuleTest {
+			tested[a.Alertname] = true
+		}
+	}
+	for _, g := range Generate(DefaultConfig()).Groups {
+		for _, r := range g.Rules {
+			if !tested[r.Alert] {
+				t.Errorf("alert %s has no test in testdata/rules_test.yml", r.Alert)
+			}
+		}
+	}
+}
+
+func TestPromtool(t *testing.T) {
+	promtool, err := exec.LookPath("promtool")
+	if err != nil {
+		t.Skip("promtool not found in PATH")
+	}
+	out, err := exec.Command(promtool, "test", "rules", "testdata/rules_test.yml").CombinedOutput()
+	if err != nil {
+		t.Errorf("promtool test rules failed: %v\n%s", err, out)
+	}
+}
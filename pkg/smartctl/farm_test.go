@@ -0,0 +1,39 @@
+package smartctl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFarmLogHeads(t *testing.T) {
+	fakeSmartctl(t, `case "$*" in
+*farm*) cat testdata/farm_log.json;;
+*) echo '{"temperature":{"current":35}}';;
+esac`)
+	s := New(0)
+	farm, err := s.FarmLog("/dev/sda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FarmHeadStatistic{
+		{Name: "fly_height_clearance_delta_inner", Head: 1, Value: -1},
+		{Name: "fly_height_clearance_delta_outer", Head: 0, Value: 2},
+		{Name: "mr_head_resistance", Head: 0, Value: 512},
+		{Name: "mr_head_resistance", Head: 1, Value: 498},
+		{Name: "reallocated_sectors", Head: 0, Value: 1},
+		{Name: "reallocated_sectors", Head: 1, Value: 2},
+	}
+	if !reflect.DeepEqual(farm.Heads, want) {
+		t.Errorf("got heads %+v, want %+v", farm.Heads, want)
+	}
+
+	// the parsed statistics survive a query which doesn't read the FARM log
+	prev := &InfoAllOutput{Device: Device{Name: "/dev/sda", Protocol: "ATA"}, SeagateFarmLog: farm.SeagateFarmLog}
+	info, err := s.Query("/dev/sda", prev, GroupTemperature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info.Heads, want) {
+		t.Errorf("got heads %+v after a temperature query, want %+v", info.Heads, want)
+	}
+}
@@ -0,0 +1,129 @@
+package smartctl
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Group is a set of device information which can be queried from smartctl independently of the rest.
+type Group string
+
+const (
+	GroupIdentity    Group = "identity"
+	GroupHealth      Group = "health"
+	GroupAttributes  Group = "attributes"
+	GroupLogs        Group = "logs"
+	GroupTemperature Group = "temperature"
+)
+
+// Groups are all groups, which together make up the output of InfoAll.
+var Groups = []Group{GroupIdentity, GroupHealth, GroupAttributes, GroupLogs, GroupTemperature}
+
+// groupArgs returns the cheapest smartctl options which output the given groups for a device last polled as prev.
+func groupArgs(prev *InfoAllOutput, groups []Group) []string {
+	args := []string{}
+	seen := map[string]bool{}
+	add := func(opt ...string) {
+		key := strings.Join(opt, " ")
+		if !seen[key] {
+			seen[key] = true
+			args = append(args, opt...)
+		}
+	}
+	for _, g := range groups {
+		switch g {
+		case GroupIdentity:
+			add("-i")
+		case GroupHealth:
+			add("-H")
+			add("-c")
+		case GroupAttributes:
+			add("-A")
+			add("-l", "devstat")
+		case GroupTemperature:
+			// ATA devices supporting SCT report the temperature in a single log, without reading the attributes.
+			// Otherwise it's only reported alongside the attributes, which for NVMe is the SMART/Health log.
+			if prev.Device.Protocol == "ATA" && prev.AtaSctCapabilities.Value != 0 {
+				add("-l", "scttempsts")
+			} else {
+				add("-A")
+			}
+		case GroupLogs:
+			add("-l", "error")
+			if prev.Device.Protocol == "ATA" {
+				add("-l", "selftest")
+				add("-l", "selective")
+			}
+		}
+	}
+	return args
+}
+
+// Query runs smartctl once to get the given groups of information about device, returning them merged over prev so
+// that the information in groups not queried keeps its previous value. All groups are queried if prev is nil. The
+// output of a command which failed, as shown by SmartExitCodeOutput.Err, is incomplete so is returned unmerged.
+func (s *smartctl) Query(device string, prev *InfoAllOutput, groups ...Group) (*InfoAllOutput, error) {
+	if prev == nil || len(groups) == len(Groups) {
+		return s.InfoAll(device)
+	}
+
+	args := groupArgs(prev, groups)
+	out, code, err := s.exec(device, append(append(args, "-j"), device)...)
+	if err != nil {
+		return nil, err
+	}
+	if code.Err() != nil {
+		failed := &InfoAllOutput{}
+		if err := json.Unmarshal(out, failed); err != nil {
+			return nil, err
+		}
+		failed.SmartExitCodeOutput = code
+		return failed, nil
+	}
+
+	// start from a deep copy of prev, so that the slices and maps it shares aren't overwritten
+	b, err := json.Marshal(prev)
+	if err != nil {
+		return nil, err
+	}
+	info := &InfoAllOutput{}
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil, err
+	}
+	// the parsed FARM head statistics aren't part of the JSON, but are never modified so can be shared
+	info.SeagateFarmLog.Heads = prev.SeagateFarmLog.Heads
+	// local_time is only output with the identity group, but records when the information was read
+	info.LocalTime = LocalTime{}
+	if err := json.Unmarshal(out, info); err != nil {
+		return nil, err
+	}
+	if info.LocalTime.TimeT == 0 {
+		now := time.Now()
+		info.LocalTime = LocalTime{TimeT: int(now.Unix()), Asctime: now.Format(time.ANSIC)}
+	}
+	info.SmartExitCodeOutput = mergeExitCode(prev.SmartExitCodeOutput, code, groups)
+	return info, nil
+}
+
+// mergeExitCode combines the exit status of a query for some groups with that of previous queries. Command errors
+// always come from the latest query, but the status bits reporting on the device are only replaced by a query of
+// the group which checks them.
+func mergeExitCode(prev, cur SmartExitCodeOutput, groups []Group) SmartExitCodeOutput {
+	merged := prev
+	merged.CommandLineParseError = cur.CommandLineParseError
+	merged.DeviceOpenFailed = cur.DeviceOpenFailed
+	merged.CommandFailed = cur.CommandFailed
+	for _, g := range groups {
+		switch g {
+		case GroupHealth:
+			merged.DiskFailing = cur.DiskFailing
+			merged.PrefailAboveThreshold = cur.PrefailAboveThreshold
+			merged.PrefailAboveThresholdInPast = cur.PrefailAboveThresholdInPast
+		case GroupLogs:
+			merged.DeviceErrorsLogged = cur.DeviceErrorsLogged
+			merged.RecentSelfTestErrors = cur.RecentSelfTestErrors
+		}
+	}
+	return merged
+}
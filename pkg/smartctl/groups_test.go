@@ -0,0 +1,149 @@
+package smartctl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupArgs(t *testing.T) {
+	ata := &InfoAllOutput{Device: Device{Protocol: "ATA"}}
+	sct := &InfoAllOutput{Device: Device{Protocol: "ATA"}, AtaSctCapabilities: AtaSctCapabilities{Value: 0x303d}}
+	nvme := &InfoAllOutput{Device: Device{Protocol: "NVMe"}}
+	tests := []struct {
+		name   string
+		prev   *InfoAllOutput
+		groups []Group
+		want   []string
+	}{
+		{"identity", ata, []Group{GroupIdentity}, []string{"-i"}},
+		{"health", ata, []Group{GroupHealth}, []string{"-H", "-c"}},
+		{"attributes", ata, []Group{GroupAttributes}, []string{"-A", "-l", "devstat"}},
+		{"ATA logs", ata, []Group{GroupLogs}, []string{"-l", "error", "-l", "selftest", "-l", "selective"}},
+		{"NVMe logs", nvme, []Group{GroupLogs}, []string{"-l", "error"}},
+		{"temperature with SCT", sct, []Group{GroupTemperature}, []string{"-l", "scttempsts"}},
+		{"temperature without SCT", ata, []Group{GroupTemperature}, []string{"-A"}},
+		{"NVMe temperature", nvme, []Group{GroupTemperature}, []string{"-A"}},
+		{"temperature and attributes", ata, []Group{GroupAttributes, GroupTemperature}, []string{"-A", "-l", "devstat"}},
+		{"health and temperature with SCT", sct, []Group{GroupHealth, GroupTemperature}, []string{"-H", "-c", "-l", "scttempsts"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupArgs(tt.prev, tt.groups); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		prev   int
+		cur    int
+		groups []Group
+		want   int
+	}{
+		{"command errors come from the latest query", 0x04, 0x02, []Group{GroupAttributes}, 0x02},
+		{"command errors clear", 0x06, 0, []Group{GroupAttributes}, 0},
+		{"health bits survive other queries", 0x38, 0, []Group{GroupAttributes, GroupLogs}, 0x38},
+		{"health bits replaced by a health query", 0x38, 0x10, []Group{GroupHealth}, 0x10},
+		{"log bits survive other queries", 0xc0, 0, []Group{GroupHealth, GroupTemperature}, 0xc0},
+		{"log bits replaced by a logs query", 0xc0, 0x40, []Group{GroupLogs}, 0x40},
+		{"bits of a group not queried are ignored", 0, 0xf8, []Group{GroupIdentity}, 0},
+		{"all bits replaced by querying all groups", 0xff, 0x08, Groups, 0x08},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeExitCode(SmartOutputFromExitCode(tt.prev), SmartOutputFromExitCode(tt.cur), tt.groups)
+			if want := SmartOutputFromExitCode(tt.want); got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestQueryMerge(t *testing.T) {
+	calls := fakeSmartctl(t, `case "$*" in
+*-H*) echo '{"smart_status":{"passed":false}}'; exit 8;;
+*-A*) echo '{"ata_smart_attributes":{"table":[{"id":194,"name":"Temperature_Celsius","raw":{"value":40,"string":"40"}}]},"temperature":{"current":40}}';;
+*error*) echo '{"ata_smart_error_log":{"summary":{"count":2}}}'; exit 64;;
+esac`)
+	prev := loadInfoAll(t, "testdata/seagate_exos_x16.json")
+	prev.SmartStatus.Passed = true
+	prev.Temperature.Current = 31
+	s := New(0)
+
+	health, err := s.Query("/dev/sda", &prev, GroupHealth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fakeCalls(t, calls); !reflect.DeepEqual(got, []string{"-H -c -j /dev/sda"}) {
+		t.Errorf("got calls %v, want a health query", got)
+	}
+	if health.SmartStatus.Passed || !health.DiskFailing {
+		t.Errorf("health query didn't update the health: %+v %+v", health.SmartStatus, health.SmartExitCodeOutput)
+	}
+	if health.SerialNumber != prev.SerialNumber || health.Temperature.Current != 31 {
+		t.Errorf("identity or temperature from the previous poll was lost: serial %q, temperature %d",
+			health.SerialNumber, health.Temperature.Current)
+	}
+	if !reflect.DeepEqual(health.AtaSmartAttributes, prev.AtaSmartAttributes) {
+		t.Error("attributes from the previous poll were lost")
+	}
+	if health.LocalTime.TimeT == 0 {
+		t.Error("local time wasn't set")
+	}
+
+	// a following attributes query keeps the failing health from the previous query
+	attrs, err := s.Query("/dev/sda", health, GroupAttributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs.AtaSmartAttributes.Table) != 1 || attrs.Temperature.Current != 40 {
+		t.Errorf("attributes query didn't update the attributes: %+v", attrs.AtaSmartAttributes.Table)
+	}
+	if attrs.SmartStatus.Passed || !attrs.DiskFailing {
+		t.Errorf("health from the previous query was lost: %+v %+v", attrs.SmartStatus, attrs.SmartExitCodeOutput)
+	}
+	if len(health.AtaSmartAttributes.Table) != len(prev.AtaSmartAttributes.Table) {
+		t.Error("querying attributes modified the previous output")
+	}
+
+	logs, err := s.Query("/dev/sda", attrs, GroupLogs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !logs.DeviceErrorsLogged || !logs.DiskFailing {
+		t.Errorf("exit status bits weren't merged: %+v", logs.SmartExitCodeOutput)
+	}
+}
+
+func TestQueryWithoutPrevious(t *testing.T) {
+	calls := fakeSmartctl(t, `echo '{"device":{"name":"/dev/sda","protocol":"ATA"},"serial_number":"ZL2XXXXX"}'`)
+	info, err := New(0).Query("/dev/sda", nil, GroupHealth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fakeCalls(t, calls); !reflect.DeepEqual(got, []string{"-iaj -l devstat /dev/sda"}) {
+		t.Errorf("got calls %v, want a query of all information", got)
+	}
+	if info.SerialNumber != "ZL2XXXXX" {
+		t.Errorf("got serial number %q, want ZL2XXXXX", info.SerialNumber)
+	}
+}
+
+func TestQueryFailureNotMerged(t *testing.T) {
+	fakeSmartctl(t, `echo '{"device":{"name":"/dev/sda"},"smartctl":{"exit_status":2}}'; exit 2`)
+	prev := loadInfoAll(t, "testdata/seagate_exos_x16.json")
+
+	info, err := New(0).Query("/dev/sda", &prev, GroupTemperature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.DeviceOpenFailed || info.SmartExitCodeOutput.Err() == nil {
+		t.Errorf("got exit status %+v, want a device open failure", info.SmartExitCodeOutput)
+	}
+	if info.SerialNumber != "" || len(info.AtaSmartAttributes.Table) != 0 {
+		t.Error("the failed query's output was merged over the previous poll")
+	}
+}
@@ -0,0 +1,148 @@
+package smartctl
+
+import (
+	"regexp"
+	"sync"
+)
+
+type RawComponent struct {
+	Name  string
+	Value float64
+}
+
+// RawDecoder splits the 48-bit raw value of an ATA SMART attribute into its components. A nil result means the raw
+// value could not be decoded.
+type RawDecoder func(raw int64) []RawComponent
+
+// RawDecoderMatch selects the attributes a RawDecoder applies to. Empty patterns match any device.
+type RawDecoderMatch struct {
+	ModelFamily string
+	ModelName   string
+	AttributeId int
+}
+
+type rawDecoderRule struct {
+	modelFamily *regexp.Regexp
+	modelName   *regexp.Regexp
+	attributeId int
+	decoder     RawDecoder
+}
+
+func (r rawDecoderRule) matches(info InfoAllOutput, attr AtaSmartAttributesTable) bool {
+	if r.attributeId != attr.Id {
+		return false
+	}
+	if r.modelFamily != nil && !r.modelFamily.MatchString(info.ModelFamily) {
+		return false
+	}
+	if r.modelName != nil && !r.modelName.MatchString(info.ModelName) {
+		return false
+	}
+	return true
+}
+
+var (
+	rawDecodersMu sync.RWMutex
+	rawDecoders   []rawDecoderRule
+)
+
+// RegisterRawDecoder adds a decoder to the registry. Decoders are tried in registration order and the first match
+// wins, so vendor-specific decoders must be registered before generic ones.
+func RegisterRawDecoder(match RawDecoderMatch, decoder RawDecoder) {
+	rule := rawDecoderRule{
+		attributeId: match.AttributeId,
+		decoder:     decoder,
+	}
+	if match.ModelFamily != "" {
+		rule.modelFamily = regexp.MustCompile(match.ModelFamily)
+	}
+	if match.ModelName != "" {
+		rule.modelName = regexp.MustCompile(match.ModelName)
+	}
+
+	rawDecodersMu.Lock()
+	defer rawDecodersMu.Unlock()
+	rawDecoders = append(rawDecoders, rule)
+}
+
+// DecodeRaw decodes the raw value of attr using the first matching registered decoder.
+func DecodeRaw(info InfoAllOutput, attr AtaSmartAttributesTable) ([]RawComponent, bool) {
+	rawDecodersMu.RLock()
+	defer rawDecodersMu.RUnlock()
+	for _, r := range rawDecoders {
+		if !r.matches(info, attr) {
+			continue
+		}
+		components := r.decoder(int64(attr.Raw.Value))
+		return components, components != nil
+	}
+	return nil, false
+}
+
+func rawBytes(raw int64, offset, length uint) float64 {
+	return float64((raw >> (offset * 8)) & (1<<(length*8) - 1))
+}
+
+// decodeErrorsAndOperations decodes Seagate's error rate attributes, where the upper 16 bits count errors and the
+// lower 32 bits count operations.
+func decodeErrorsAndOperations(raw int64) []RawComponent {
+	return []RawComponent{
+		{Name: "errors", Value: rawBytes(raw, 4, 2)},
+		{Name: "operations", Value: rawBytes(raw, 0, 4)},
+	}
+}
+
+// decodeHoursAndMilliseconds decodes Seagate's Power_On_Hours (smartctl's msec24hour32), where the lower 32 bits
+// count hours and the next 24 bits count milliseconds into the current hour, up to 3,600,000.
+func decodeHoursAndMilliseconds(raw int64) []RawComponent {
+	return []RawComponent{
+		{Name: "hours", Value: rawBytes(raw, 0, 4)},
+		{Name: "milliseconds", Value: rawBytes(raw, 4, 3)},
+	}
+}
+
+// decodeThreeCounters decodes attributes which pack three 16-bit counters, such as Seagate's Command_Timeout.
+func decodeThreeCounters(names ...string) RawDecoder {
+	return func(raw int64) []RawComponent {
+		components := []RawComponent{}
+		for i, n := range names {
+			components = append(components, RawComponent{Name: n, Value: rawBytes(raw, uint(i*2), 2)})
+		}
+		return components
+	}
+}
+
+// temperatureMinMaxLayouts are the byte offsets of the lifetime minimum and maximum temperatures used by different
+// vendors, in the order smartctl tries them: bytes 2 and 4 (Hitachi/HGST), then bytes 2 and 3 (Seagate, Samsung,
+// Toshiba).
+var temperatureMinMaxLayouts = [][2]uint{{2, 4}, {2, 3}}
+
+// decodeTemperatureMinMax decodes temperatures which pack the current value in byte 0 alongside the lifetime
+// minimum and maximum. Values that don't look like a min/current/max triple only report the current value.
+func decodeTemperatureMinMax(raw int64) []RawComponent {
+	current := rawBytes(raw, 0, 1)
+	components := []RawComponent{{Name: "current", Value: current}}
+	for _, l := range temperatureMinMaxLayouts {
+		min, max := rawBytes(raw, l[0], 1), rawBytes(raw, l[1], 1)
+		if min > 0 && min <= current && current <= max {
+			return append(components,
+				RawComponent{Name: "min", Value: min},
+				RawComponent{Name: "max", Value: max},
+			)
+		}
+	}
+	return components
+}
+
+func init() {
+	seagateFamily := "^Seagate"
+	RegisterRawDecoder(RawDecoderMatch{ModelFamily: seagateFamily, AttributeId: 1}, decodeErrorsAndOperations)
+	RegisterRawDecoder(RawDecoderMatch{ModelFamily: seagateFamily, AttributeId: 7}, decodeErrorsAndOperations)
+	RegisterRawDecoder(RawDecoderMatch{ModelFamily: seagateFamily, AttributeId: 195}, decodeErrorsAndOperations)
+	RegisterRawDecoder(RawDecoderMatch{ModelFamily: seagateFamily, AttributeId: 9}, decodeHoursAndMilliseconds)
+	RegisterRawDecoder(RawDecoderMatch{ModelFamily: seagateFamily, AttributeId: 188},
+		decodeThreeCounters("timeouts", "timeouts_over_5s", "timeouts_over_7_5s"))
+
+	RegisterRawDecoder(RawDecoderMatch{AttributeId: 190}, decodeTemperatureMinMax)
+	RegisterRawDecoder(RawDecoderMatch{AttributeId: 194}, decodeTemperatureMinMax)
+}
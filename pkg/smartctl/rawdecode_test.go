@@ -0,0 +1,74 @@
+package smartctl
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func loadInfoAll(t *testing.T, path string) InfoAllOutput {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := InfoAllOutput{}
+	if err := json.Unmarshal(b, &info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestDecodeRawSeagate(t *testing.T) {
+	info := loadInfoAll(t, "testdata/seagate_exos_x16.json")
+
+	tests := []struct {
+		id   int
+		want []RawComponent
+	}{
+		{1, []RawComponent{{"errors", 0}, {"operations", 171884536}}},
+		{7, []RawComponent{{"errors", 1}, {"operations", 451290345}}},
+		// 23410h+47m+44.123s: the milliseconds don't fit in 16 bits
+		{9, []RawComponent{{"hours", 23410}, {"milliseconds", 2864123}}},
+		{188, []RawComponent{{"timeouts", 2}, {"timeouts_over_5s", 1}, {"timeouts_over_7_5s", 1}}},
+		// 31 (Min/Max 16/44)
+		{190, []RawComponent{{"current", 31}, {"min", 16}, {"max", 44}}},
+		// 31 (0 16 0 0 0): no min/max triple
+		{194, []RawComponent{{"current", 31}}},
+		{195, []RawComponent{{"errors", 0}, {"operations", 171884536}}},
+	}
+
+	attrs := map[int]AtaSmartAttributesTable{}
+	for _, a := range info.AtaSmartAttributes.Table {
+		attrs[a.Id] = a
+	}
+	for _, tt := range tests {
+		attr, ok := attrs[tt.id]
+		if !ok {
+			t.Fatalf("attribute %d missing from fixture", tt.id)
+		}
+		got, ok := DecodeRaw(info, attr)
+		if !ok {
+			t.Errorf("attribute %d (%s): not decoded", tt.id, attr.Name)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("attribute %d (%s): got %v, want %v", tt.id, attr.Name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeRawVendorSpecific(t *testing.T) {
+	info := InfoAllOutput{ModelFamily: "Western Digital Red", ModelName: "WDC WD40EFRX-68N32N0"}
+	// Seagate packing of the error rate doesn't apply to other vendors
+	if _, ok := DecodeRaw(info, AtaSmartAttributesTable{Id: 1, Raw: AtaSmartAttributesRaw{Value: 4746257641}}); ok {
+		t.Error("attribute 1 decoded for a non-Seagate drive")
+	}
+	// Hitachi/HGST layout: 35 (Min/Max 20/48)
+	got, ok := DecodeRaw(info, AtaSmartAttributesTable{Id: 194, Raw: AtaSmartAttributesRaw{Value: 48<<32 | 20<<16 | 35}})
+	want := []RawComponent{{"current", 35}, {"min", 20}, {"max", 48}}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("attribute 194: got %v, want %v", got, want)
+	}
+}
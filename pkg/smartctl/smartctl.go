@@ -1,16 +1,26 @@
 package smartctl
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"os/exec"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 type SmartCtl interface {
 	ScanOpen() (*ScanOpenOutput, error)
 	InfoAll(device string) (*InfoAllOutput, error)
+	Query(device string, prev *InfoAllOutput, groups ...Group) (*InfoAllOutput, error)
+	FarmLog(device string) (*FarmLogOutput, error)
+	Version() (*VersionOutput, error)
+	Forget(device string)
 }
 
 type SmartExitCodeOutput struct {
@@ -24,6 +34,30 @@ type SmartExitCodeOutput struct {
 	RecentSelfTestErrors        bool
 }
 
+// ExitError reports that smartctl couldn't get information from a device. smartctl may still output valid JSON in
+// that case, but it is incomplete.
+type ExitError struct {
+	SmartExitCodeOutput
+}
+
+func (e *ExitError) Error() string {
+	switch {
+	case e.CommandLineParseError:
+		return "smartctl failed to parse its command line"
+	case e.DeviceOpenFailed:
+		return "smartctl failed to open the device"
+	}
+	return "a command to the device failed"
+}
+
+// Err returns an *ExitError if the exit status shows that smartctl failed, rather than reporting on the device.
+func (o SmartExitCodeOutput) Err() error {
+	if o.CommandLineParseError || o.DeviceOpenFailed || o.CommandFailed {
+		return &ExitError{o}
+	}
+	return nil
+}
+
 func SmartOutputFromExitCode(exitCode int) SmartExitCodeOutput {
 	return SmartExitCodeOutput{
 		CommandLineParseError:       exitCode&0x1 != 0,
@@ -37,31 +71,132 @@ func SmartOutputFromExitCode(exitCode int) SmartExitCodeOutput {
 	}
 }
 
+// RawOutput is the unparsed result of a smartctl invocation, kept for debugging.
+type RawOutput struct {
+	Argv     []string  `json:"argv"`
+	ExitCode int       `json:"exit_code"`
+	Time     time.Time `json:"time"`
+	Stdout   []byte    `json:"stdout"`
+	Stderr   []byte    `json:"stderr,omitempty"`
+}
+
 type smartctl struct {
 	logger zerolog.Logger
+	// timeout limits how long each smartctl command may run for, if positive
+	timeout time.Duration
+
+	mu sync.RWMutex
+	// version is the installed smartctl version, once detected
+	version Version
+	// checked is when the binary was last checked by DetectVersion or Ready, and checkErr the result of the check
+	checked  time.Time
+	checkErr error
+	// raw holds the last output of each distinct command, by device
+	raw map[string]map[string]RawOutput
+	// serials holds the serial number last reported by each device, for log context
+	serials map[string]string
 }
 
-func New() *smartctl {
+// New returns a SmartCtl which runs the smartctl binary on the PATH, killing any command which runs for longer than
+// timeout. Zero disables the timeout.
+func New(timeout time.Duration) *smartctl {
 	return &smartctl{
-		logger: log.With().Str("component", "smartctl").Logger(),
+		logger:  log.With().Str("component", "smartctl").Logger(),
+		timeout: timeout,
+		raw:     map[string]map[string]RawOutput{},
+		serials: map[string]string{},
+	}
+}
+
+// deviceLogger returns a logger with the device, and its serial number once known, attached.
+func (s *smartctl) deviceLogger(device string) zerolog.Logger {
+	if device == "" {
+		return s.logger
+	}
+	s.mu.RLock()
+	serial := s.serials[device]
+	s.mu.RUnlock()
+	ctx := s.logger.With().Str("device", device)
+	if serial != "" {
+		ctx = ctx.Str("serial", serial)
 	}
+	return ctx.Logger()
 }
 
-func (s *smartctl) exec(args ...string) ([]byte, SmartExitCodeOutput, error) {
-	cmd := exec.Command("smartctl", args...)
-	s.logger.Debug().
+func (s *smartctl) exec(device string, args ...string) ([]byte, SmartExitCodeOutput, error) {
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "smartctl", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	logger := s.deviceLogger(device)
+	logger.Debug().
 		Str("command", strings.Join(cmd.Args, " ")).
 		Msg("executing command")
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		s.logger.Error().Err(err).Msgf("failed to execute command. Command output: %s", string(out))
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			// a device which hangs mustn't hold up polling the others indefinitely
+			return nil, SmartExitCodeOutput{}, fmt.Errorf("smartctl timed out after %s", s.timeout)
+		}
+		if cmd.ProcessState == nil {
+			// smartctl couldn't be started at all, e.g. it isn't installed
+			return nil, SmartExitCodeOutput{}, err
+		}
 		// ignore error if command failed - normally indicates a SMART failure, so we pass back the exit code information
+		logger.Debug().
+			Err(err).
+			Int("exit_code", cmd.ProcessState.ExitCode()).
+			Str("stderr", stderr.String()).
+			Msg("command exited with non-zero status")
 	}
-	return out, SmartOutputFromExitCode(cmd.ProcessState.ExitCode()), nil
+	exitCode := cmd.ProcessState.ExitCode()
+
+	if device != "" {
+		s.mu.Lock()
+		if s.raw[device] == nil {
+			s.raw[device] = map[string]RawOutput{}
+		}
+		s.raw[device][strings.Join(cmd.Args, " ")] = RawOutput{
+			Argv:     cmd.Args,
+			ExitCode: exitCode,
+			Time:     start,
+			Stdout:   stdout.Bytes(),
+			Stderr:   stderr.Bytes(),
+		}
+		s.mu.Unlock()
+	}
+
+	return stdout.Bytes(), SmartOutputFromExitCode(exitCode), nil
+}
+
+// RawOutputs returns the last output of each command run against device, oldest first.
+func (s *smartctl) RawOutputs(device string) []RawOutput {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	outputs := []RawOutput{}
+	for _, o := range s.raw[device] {
+		outputs = append(outputs, o)
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Time.Before(outputs[j].Time) })
+	return outputs
+}
+
+// Forget drops the raw outputs and serial number kept for device, once it has been removed.
+func (s *smartctl) Forget(device string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.raw, device)
+	delete(s.serials, device)
 }
 
 func (s *smartctl) ScanOpen() (*ScanOpenOutput, error) {
-	out, code, err := s.exec("--scan-open", "-j")
+	out, code, err := s.exec("", "--scan-open", "-j")
 	if err != nil {
 		return nil, err
 	}
@@ -73,8 +208,8 @@ func (s *smartctl) ScanOpen() (*ScanOpenOutput, error) {
 	return scanOpenOutput, nil
 }
 
-func (s smartctl) InfoAll(device string) (*InfoAllOutput, error) {
-	out, code, err := s.exec("-iaj", device)
+func (s *smartctl) InfoAll(device string) (*InfoAllOutput, error) {
+	out, code, err := s.exec(device, "-iaj", "-l", "devstat", device)
 	if err != nil {
 		return nil, err
 	}
@@ -83,5 +218,24 @@ func (s smartctl) InfoAll(device string) (*InfoAllOutput, error) {
 		return nil, err
 	}
 	infoAllOutput.SmartExitCodeOutput = code
+	if infoAllOutput.SerialNumber != "" {
+		s.mu.Lock()
+		s.serials[device] = infoAllOutput.SerialNumber
+		s.mu.Unlock()
+	}
 	return infoAllOutput, nil
 }
+
+func (s *smartctl) FarmLog(device string) (*FarmLogOutput, error) {
+	out, code, err := s.exec(device, "-l", "farm", "-j", device)
+	if err != nil {
+		return nil, err
+	}
+	farmLogOutput := &FarmLogOutput{}
+	if err := json.Unmarshal(out, farmLogOutput); err != nil {
+		return nil, err
+	}
+	farmLogOutput.SmartExitCodeOutput = code
+	farmLogOutput.Heads = farmLogOutput.headStatistics()
+	return farmLogOutput, nil
+}
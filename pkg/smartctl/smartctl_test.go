@@ -0,0 +1,76 @@
+package smartctl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSmartctl puts a smartctl shell script running script first on the PATH for the duration of the test. Each
+// invocation's arguments are appended to the file returned.
+func fakeSmartctl(t *testing.T, script string) string {
+	t.Helper()
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	body := "#!/bin/sh\necho \"$*\" >> " + calls + "\n" + script + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "smartctl"), []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+// fakeCalls returns the arguments of each invocation of a fake smartctl.
+func fakeCalls(t *testing.T, calls string) []string {
+	t.Helper()
+	b, err := os.ReadFile(calls)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestExitStatusErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		err  string
+	}{
+		{"success", 0, ""},
+		{"health bits", 0x8 | 0x40, ""},
+		{"command line parse error", 0x1, "parse its command line"},
+		{"device open failed", 0x2, "failed to open the device"},
+		{"command failed", 0x4 | 0x8, "command to the device failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SmartOutputFromExitCode(tt.code).Err()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if _, ok := err.(*ExitError); !ok || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want an *ExitError containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	fakeSmartctl(t, "exec sleep 10")
+	start := time.Now()
+	_, err := New(100 * time.Millisecond).InfoAll("/dev/sda")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("smartctl wasn't killed until %s", elapsed)
+	}
+}
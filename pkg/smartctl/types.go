@@ -1,5 +1,13 @@
 package smartctl
 
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 type SmartCtlInfo struct {
 	SmartCtlVersion []int    `json:"version"`
 	SvnRevision     string   `json:"svn_revision"`
@@ -199,33 +207,188 @@ type AtaSmartSelectiveSelfTestLog struct {
 	PowerUpScanResumeMinutes int                                 `json:"power_up_scan_resume_minutes"`
 }
 
+type AtaDeviceStatisticsFlags struct {
+	Value                 int    `json:"value"`
+	String                string `json:"string"`
+	Valid                 bool   `json:"valid"`
+	Normalized            bool   `json:"normalized"`
+	SupportsDsn           bool   `json:"supports_dsn"`
+	MonitoredConditionMet bool   `json:"monitored_condition_met"`
+}
+
+type AtaDeviceStatisticsTable struct {
+	Offset int                      `json:"offset"`
+	Name   string                   `json:"name"`
+	Size   int                      `json:"size"`
+	Value  int64                    `json:"value"`
+	Flags  AtaDeviceStatisticsFlags `json:"flags"`
+}
+
+type AtaDeviceStatisticsPage struct {
+	Number   int                        `json:"number"`
+	Name     string                     `json:"name"`
+	Revision int                        `json:"revision"`
+	Table    []AtaDeviceStatisticsTable `json:"table"`
+}
+
+type AtaDeviceStatistics struct {
+	Pages []AtaDeviceStatisticsPage `json:"pages"`
+}
+
+type FarmHeadStatistic struct {
+	Name  string
+	Head  int
+	Value float64
+}
+
+var farmHeadKeyRegexp = regexp.MustCompile(`^(.+?)_(?:by|from)_head_(\d+)(?:_(\w+))?$`)
+
+type SeagateFarmLog struct {
+	DriveInformation      map[string]json.RawMessage `json:"page_1_drive_information"`
+	ReliabilityStatistics map[string]json.RawMessage `json:"page_5_reliability_statistics"`
+	// Heads are the per-head reliability statistics, parsed once when the log is read.
+	Heads []FarmHeadStatistic `json:"-"`
+}
+
+// headStatistics returns the numeric per-head entries ("<name>_by_head_<n>[_<suffix>]") of the reliability
+// statistics page.
+func (l SeagateFarmLog) headStatistics() []FarmHeadStatistic {
+	stats := []FarmHeadStatistic{}
+	for k, raw := range l.ReliabilityStatistics {
+		m := farmHeadKeyRegexp.FindStringSubmatch(k)
+		if m == nil {
+			continue
+		}
+		var v float64
+		if err := json.Unmarshal(raw, &v); err != nil {
+			continue
+		}
+		head, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		name := m[1]
+		if m[3] != "" {
+			name += "_" + m[3]
+		}
+		stats = append(stats, FarmHeadStatistic{Name: name, Head: head, Value: v})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Name != stats[j].Name {
+			return stats[i].Name < stats[j].Name
+		}
+		return stats[i].Head < stats[j].Head
+	})
+	return stats
+}
+
+type FarmLogOutput struct {
+	SmartExitCodeOutput
+	SmartCtlInfo   `json:"smartctl"`
+	SeagateFarmLog `json:"seagate_farm_log"`
+}
+
+type NvmeNamespaceSize struct {
+	Blocks int64 `json:"blocks"`
+	Bytes  int64 `json:"bytes"`
+}
+
+type NvmeNamespace struct {
+	Id               int               `json:"id"`
+	Size             NvmeNamespaceSize `json:"size"`
+	Capacity         NvmeNamespaceSize `json:"capacity"`
+	Utilization      NvmeNamespaceSize `json:"utilization"`
+	FormattedLbaSize int               `json:"formatted_lba_size"`
+}
+
+type NvmeErrorInformationLogStatusField struct {
+	Value          int    `json:"value"`
+	DoNotRetry     bool   `json:"do_not_retry"`
+	StatusCodeType int    `json:"status_code_type"`
+	StatusCode     int    `json:"status_code"`
+	String         string `json:"string"`
+}
+
+type NvmeErrorInformationLogTable struct {
+	ErrorCount        int64                              `json:"error_count"`
+	SubmissionQueueId int                                `json:"submission_queue_id"`
+	CommandId         int                                `json:"command_id"`
+	StatusField       NvmeErrorInformationLogStatusField `json:"status_field"`
+	PhaseTag          bool                               `json:"phase_tag"`
+	ParmErrorLocation int                                `json:"parm_error_location"`
+	Lba               struct {
+		Value int64 `json:"value"`
+	} `json:"lba"`
+	Nsid int64 `json:"nsid"`
+}
+
+type NvmeErrorInformationLog struct {
+	Size   int                            `json:"size"`
+	Read   int                            `json:"read"`
+	Unread int                            `json:"unread"`
+	Table  []NvmeErrorInformationLogTable `json:"table"`
+}
+
+type NvmeSmartHealthInformationLog struct {
+	CriticalWarning         int   `json:"critical_warning"`
+	Temperature             int   `json:"temperature"`
+	AvailableSpare          int   `json:"available_spare"`
+	AvailableSpareThreshold int   `json:"available_spare_threshold"`
+	PercentageUsed          int   `json:"percentage_used"`
+	DataUnitsRead           int64 `json:"data_units_read"`
+	DataUnitsWritten        int64 `json:"data_units_written"`
+	HostReads               int64 `json:"host_reads"`
+	HostWrites              int64 `json:"host_writes"`
+	ControllerBusyTime      int64 `json:"controller_busy_time"`
+	PowerCycles             int64 `json:"power_cycles"`
+	PowerOnHours            int64 `json:"power_on_hours"`
+	UnsafeShutdowns         int64 `json:"unsafe_shutdowns"`
+	MediaErrors             int64 `json:"media_errors"`
+	NumErrLogEntries        int64 `json:"num_err_log_entries"`
+	WarningTempTime         int64 `json:"warning_temp_time"`
+	CriticalCompTime        int64 `json:"critical_comp_time"`
+}
+
 type InfoAllOutput struct {
 	SmartExitCodeOutput
 	SmartCtlInfo `json:"smartctl"`
 
-	Device                       `json:"device"`
-	ModelFamily                  string `json:"model_family"`
-	ModelName                    string `json:"model_name"`
-	SerialNumber                 string `json:"serial_number"`
-	Wwn                          `json:"wwn"`
-	FirmwareVersion              string `json:"firmware_version"`
-	UserCapacity                 `json:"user_capacity"`
-	LogicalBlockSize             int64 `json:"logical_block_size"`
-	PhysicalBlockSize            int64 `json:"physical_block_size"`
-	Trim                         `json:"trim"`
-	InSmartctlDatabase           bool `json:"in_smartctl_database"`
-	AtaVersion                   `json:"ata_version"`
-	SataVersion                  `json:"sata_version"`
-	InterfaceSpeed               `json:"interface_speed"`
-	LocalTime                    `json:"local_time"`
-	SmartStatus                  `json:"smart_status"`
-	AtaSmartData                 `json:"ata_smart_data"`
-	AtaSctCapabilities           `json:"ata_sct_capabilities"`
-	AtaSmartAttributes           `json:"ata_smart_attributes"`
-	PowerOnTime                  `json:"power_on_time"`
-	PowerCycleCount              int `json:"power_cycle_count"`
-	Temperature                  `json:"temperature"`
-	AtaSmartErrorLog             `json:"ata_smart_error_log"`
-	AtaSmartSelfTestLog          `json:"ata_smart_self_test_log"`
-	AtaSmartSelectiveSelfTestLog `json:"ata_smart_selective_self_test_log"`
+	Device                        `json:"device"`
+	ModelFamily                   string `json:"model_family"`
+	ModelName                     string `json:"model_name"`
+	SerialNumber                  string `json:"serial_number"`
+	Wwn                           `json:"wwn"`
+	FirmwareVersion               string `json:"firmware_version"`
+	UserCapacity                  `json:"user_capacity"`
+	LogicalBlockSize              int64 `json:"logical_block_size"`
+	PhysicalBlockSize             int64 `json:"physical_block_size"`
+	Trim                          `json:"trim"`
+	InSmartctlDatabase            bool `json:"in_smartctl_database"`
+	AtaVersion                    `json:"ata_version"`
+	SataVersion                   `json:"sata_version"`
+	InterfaceSpeed                `json:"interface_speed"`
+	LocalTime                     `json:"local_time"`
+	SmartStatus                   `json:"smart_status"`
+	AtaSmartData                  `json:"ata_smart_data"`
+	AtaSctCapabilities            `json:"ata_sct_capabilities"`
+	AtaSmartAttributes            `json:"ata_smart_attributes"`
+	PowerOnTime                   `json:"power_on_time"`
+	PowerCycleCount               int `json:"power_cycle_count"`
+	Temperature                   `json:"temperature"`
+	AtaSmartErrorLog              `json:"ata_smart_error_log"`
+	AtaSmartSelfTestLog           `json:"ata_smart_self_test_log"`
+	AtaSmartSelectiveSelfTestLog  `json:"ata_smart_selective_self_test_log"`
+	AtaDeviceStatistics           `json:"ata_device_statistics"`
+	SeagateFarmLog                `json:"seagate_farm_log"`
+	NvmeNamespaces                []NvmeNamespace `json:"nvme_namespaces"`
+	NvmeErrorInformationLog       `json:"nvme_error_information_log"`
+	NvmeSmartHealthInformationLog `json:"nvme_smart_health_information_log"`
+}
+
+// Identity identifies the physical device independently of its device name, in the style of /dev/disk/by-id.
+func (o InfoAllOutput) Identity() string {
+	if o.SerialNumber == "" {
+		return o.Device.Name
+	}
+	return strings.ReplaceAll(strings.TrimSpace(o.ModelName), " ", "_") + "_" + o.SerialNumber
 }
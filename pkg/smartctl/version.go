@@ -0,0 +1,115 @@
+package smartctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version is a smartctl release number.
+type Version struct {
+	Major int
+	Minor int
+}
+
+var (
+	// MinimumVersion is the oldest smartctl release whose JSON output the exporter understands.
+	MinimumVersion = Version{Major: 7, Minor: 2}
+	// FarmLogVersion is the first release able to read the Seagate FARM log (-l farm).
+	FarmLogVersion = Version{Major: 7, Minor: 4}
+)
+
+// versionCheckInterval is how long Ready trusts the last check of the smartctl binary, so that readiness probes
+// don't each run it.
+const versionCheckInterval = 5 * time.Minute
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// AtLeast reports whether v is the same release as o or a later one.
+func (v Version) AtLeast(o Version) bool {
+	return v.Major > o.Major || (v.Major == o.Major && v.Minor >= o.Minor)
+}
+
+// Version returns the release of smartctl which produced the output.
+func (i SmartCtlInfo) Version() Version {
+	v := Version{}
+	if len(i.SmartCtlVersion) > 0 {
+		v.Major = i.SmartCtlVersion[0]
+	}
+	if len(i.SmartCtlVersion) > 1 {
+		v.Minor = i.SmartCtlVersion[1]
+	}
+	return v
+}
+
+type VersionOutput struct {
+	SmartExitCodeOutput
+	SmartCtlInfo `json:"smartctl"`
+}
+
+func (s *smartctl) Version() (*VersionOutput, error) {
+	out, code, err := s.exec("", "--version", "-j")
+	if err != nil {
+		return nil, err
+	}
+	versionOutput := &VersionOutput{}
+	if err := json.Unmarshal(out, versionOutput); err != nil {
+		return nil, fmt.Errorf("failed to parse smartctl version, it may be older than %s: %w", MinimumVersion, err)
+	}
+	versionOutput.SmartExitCodeOutput = code
+	return versionOutput, nil
+}
+
+func (s *smartctl) checkVersion() (Version, error) {
+	out, err := s.Version()
+	if err != nil {
+		return Version{}, fmt.Errorf("smartctl is unavailable: %w", err)
+	}
+	v := out.SmartCtlInfo.Version()
+	if !v.AtLeast(MinimumVersion) {
+		return v, fmt.Errorf("smartctl %s is older than the minimum supported version %s, please upgrade smartmontools", v, MinimumVersion)
+	}
+	return v, nil
+}
+
+// DetectVersion finds the installed smartctl version, which determines the optional logs requested from it. It
+// returns an error if smartctl can't be run or is older than MinimumVersion.
+func (s *smartctl) DetectVersion() (Version, error) {
+	v, err := s.checkVersion()
+	s.mu.Lock()
+	s.checked, s.checkErr = time.Now(), err
+	if err == nil {
+		s.version = v
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return v, err
+	}
+	s.logger.Info().Str("version", v.String()).Msg("detected smartctl version")
+	return v, nil
+}
+
+// Supports reports whether the version found by DetectVersion is at least since.
+func (s *smartctl) Supports(since Version) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version.AtLeast(since)
+}
+
+// Ready returns an error unless the smartctl binary can be run and is at least MinimumVersion. The binary is only
+// checked again once versionCheckInterval has passed since the last check, so that it can be probed frequently.
+func (s *smartctl) Ready() error {
+	s.mu.RLock()
+	checked, err := s.checked, s.checkErr
+	s.mu.RUnlock()
+	if !checked.IsZero() && time.Since(checked) < versionCheckInterval {
+		return err
+	}
+	_, err = s.checkVersion()
+	s.mu.Lock()
+	s.checked, s.checkErr = time.Now(), err
+	s.mu.Unlock()
+	return err
+}
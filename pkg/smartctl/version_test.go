@@ -0,0 +1,65 @@
+package smartctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		v, o Version
+		want bool
+	}{
+		{Version{7, 2}, Version{7, 2}, true},
+		{Version{7, 3}, Version{7, 2}, true},
+		{Version{8, 0}, Version{7, 4}, true},
+		{Version{7, 1}, Version{7, 2}, false},
+		{Version{6, 9}, Version{7, 0}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.v.AtLeast(tt.o); got != tt.want {
+			t.Errorf("%s.AtLeast(%s) = %v, want %v", tt.v, tt.o, got, tt.want)
+		}
+	}
+}
+
+func TestReadyCachesCheck(t *testing.T) {
+	calls := fakeSmartctl(t, `echo '{"smartctl":{"version":[7,3]}}'`)
+	s := New(0)
+	if _, err := s.DetectVersion(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.Ready(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(fakeCalls(t, calls)); n != 1 {
+		t.Errorf("smartctl ran %d times, want once until the check expires", n)
+	}
+
+	s.checked = time.Now().Add(-versionCheckInterval)
+	if err := s.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fakeCalls(t, calls)); n != 2 {
+		t.Errorf("smartctl ran %d times, want it checked again after the check expires", n)
+	}
+}
+
+func TestReadyCachesFailure(t *testing.T) {
+	calls := fakeSmartctl(t, `echo '{"smartctl":{"version":[7,1]}}'`)
+	s := New(0)
+	if _, err := s.DetectVersion(); err == nil {
+		t.Fatal("expected an error for smartctl 7.1")
+	}
+	if err := s.Ready(); err == nil {
+		t.Error("expected Ready to fail for smartctl 7.1")
+	}
+	if n := len(fakeCalls(t, calls)); n != 1 {
+		t.Errorf("smartctl ran %d times, want once", n)
+	}
+	if s.Supports(MinimumVersion) {
+		t.Error("unsupported version was recorded")
+	}
+}
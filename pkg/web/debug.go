@@ -0,0 +1,101 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type RawOutputSource interface {
+	RawOutputs(device string) []smartctl.RawOutput
+}
+
+type rawOutputResponse struct {
+	Argv     []string    `json:"argv"`
+	ExitCode int         `json:"exit_code"`
+	Time     time.Time   `json:"time"`
+	Stdout   interface{} `json:"stdout"`
+	Stderr   string      `json:"stderr,omitempty"`
+}
+
+// redactedKeys are smartctl JSON keys identifying a physical device.
+var redactedKeys = map[string]bool{
+	"serial_number":   true,
+	"wwn":             true,
+	"eui64":           true,
+	"nguid":           true,
+	"logical_unit_id": true,
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if redactedKeys[k] {
+				v[k] = "REDACTED"
+				continue
+			}
+			v[k] = redact(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redact(child)
+		}
+	}
+	return v
+}
+
+func rawOutputView(o smartctl.RawOutput, redactIdentifiers bool) rawOutputResponse {
+	resp := rawOutputResponse{
+		Argv:     o.Argv,
+		ExitCode: o.ExitCode,
+		Time:     o.Time,
+		Stderr:   string(o.Stderr),
+	}
+	var stdout interface{}
+	if err := json.Unmarshal(o.Stdout, &stdout); err != nil {
+		// not JSON, so it can't be redacted structurally
+		resp.Stdout = string(o.Stdout)
+		if redactIdentifiers {
+			resp.Stdout = "REDACTED"
+		}
+		return resp
+	}
+	if redactIdentifiers {
+		stdout = redact(stdout)
+	}
+	resp.Stdout = stdout
+	return resp
+}
+
+// RawOutputHandler serves the last raw output of each smartctl command run against a device at
+// /debug/smartctl/{device}, where device is the device name with or without its /dev/ prefix.
+func RawOutputHandler(s RawOutputSource, redactIdentifiers bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		device := strings.Trim(strings.TrimPrefix(r.URL.Path, "/debug/smartctl"), "/")
+		if device == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("no device given"))
+			return
+		}
+
+		var outputs []smartctl.RawOutput
+		for _, name := range []string{device, "/" + device, "/dev/" + device} {
+			if outputs = s.RawOutputs(name); len(outputs) > 0 {
+				break
+			}
+		}
+		if len(outputs) == 0 {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no smartctl output for device %s", device))
+			return
+		}
+
+		views := []rawOutputResponse{}
+		for _, o := range outputs {
+			views = append(views, rawOutputView(o, redactIdentifiers))
+		}
+		writeJSON(w, http.StatusOK, views)
+	})
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/collector"
+	"net/http"
+	"path"
+	"strings"
+)
+
+type DeviceLister interface {
+	Devices() []collector.DeviceStatus
+}
+
+// findDevice looks a device up by identity, device name or the base of its device name, e.g. "sda".
+func findDevice(l DeviceLister, id string) (collector.DeviceStatus, bool) {
+	for _, d := range l.Devices() {
+		if d.Identity == id || strings.TrimPrefix(d.Device, "/") == id || path.Base(d.Device) == id {
+			return d, true
+		}
+	}
+	return collector.DeviceStatus{}, false
+}
+
+// DevicesHandler serves the device inventory:
+//
+//	GET /api/v1/devices        the status and latest information of every device
+//	GET /api/v1/devices/{id}   a single device, by identity or device name
+func DevicesHandler(l DeviceLister) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/devices"), "/")
+		if id == "" {
+			writeJSON(w, http.StatusOK, l.Devices())
+			return
+		}
+
+		d, ok := findDevice(l, id)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no such device %s", id))
+			return
+		}
+		writeJSON(w, http.StatusOK, d)
+	})
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/milesbxf/smartmon-exporter/pkg/events"
+	"net/http"
+	"strings"
+)
+
+// EventsHandler serves attribute change events at /api/v1/events: the retained events as JSON, or a live
+// Server-Sent Events stream if the client accepts text/event-stream.
+func EventsHandler(broker *events.Broker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			writeJSON(w, http.StatusOK, broker.Recent())
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+			return
+		}
+
+		ch, cancel := broker.Subscribe()
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: change\ndata: %s\n\n", data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
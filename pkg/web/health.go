@@ -0,0 +1,34 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ReadinessCheck returns an error describing why a component isn't ready to serve.
+type ReadinessCheck interface {
+	Ready() error
+}
+
+// HealthyHandler reports that the process is up.
+func HealthyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "Healthy")
+	})
+}
+
+// ReadyHandler reports whether all checks pass, responding 503 with the first failure otherwise.
+func ReadyHandler(checks ...ReadinessCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, c := range checks {
+			if err := c.Ready(); err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, "Not ready: %s\n", err)
+				return
+			}
+		}
+		fmt.Fprintln(w, "Ready")
+	})
+}
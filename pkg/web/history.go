@@ -0,0 +1,70 @@
+package web
+
+import (
+	"errors"
+	"github.com/milesbxf/smartmon-exporter/pkg/history"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HistoryHandler serves the stored attribute history:
+//
+//	GET /api/v1/history                                   device identities with stored history
+//	GET /api/v1/history/{identity}?attribute=&from=&to=   attribute time series, or all snapshots if no attribute
+//
+// from and to are RFC 3339 timestamps and default to the last 24 hours.
+func HistoryHandler(store *history.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		identity := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/history"), "/")
+		if identity == "" {
+			devices, err := store.Devices()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, devices)
+			return
+		}
+
+		to, err := parseTime(r.URL.Query().Get("to"), time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		from, err := parseTime(r.URL.Query().Get("from"), to.Add(-24*time.Hour))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if attribute := r.URL.Query().Get("attribute"); attribute != "" {
+			points, err := store.AttributeSeries(identity, attribute, from, to)
+			if err != nil {
+				writeError(w, http.StatusNotFound, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, points)
+			return
+		}
+
+		snapshots, err := store.Snapshots(identity, from, to)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, snapshots)
+	})
+}
+
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
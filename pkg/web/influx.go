@@ -0,0 +1,23 @@
+package web
+
+import (
+	"github.com/milesbxf/smartmon-exporter/pkg/output"
+	"github.com/milesbxf/smartmon-exporter/pkg/smartctl"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+type Snapshotter interface {
+	Snapshot() []smartctl.InfoAllOutput
+}
+
+// InfluxHandler serves the latest device information in InfluxDB line protocol.
+func InfluxHandler(s Snapshotter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := output.WriteInflux(w, s.Snapshot(), time.Now()); err != nil {
+			log.Error().Err(err).Msg("failed to write influx response")
+		}
+	})
+}
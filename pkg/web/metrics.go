@@ -0,0 +1,33 @@
+package web
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Refresher interface {
+	Refresh(ctx context.Context, maxAge time.Duration) error
+}
+
+// FreshMetricsHandler refreshes data older than maxAge before serving a scrape with next. The refresh is bounded by
+// the scrape timeout Prometheus sends, less a margin for rendering the response, or by timeout if it sends none.
+// Stale data is served if the refresh doesn't complete in time.
+func FreshMetricsHandler(next http.Handler, r Refresher, maxAge, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		scrapeTimeout := timeout
+		if v := req.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+			if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+				scrapeTimeout = time.Duration(seconds * 0.9 * float64(time.Second))
+			}
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), scrapeTimeout)
+		defer cancel()
+		if err := r.Refresh(ctx, maxAge); err != nil {
+			log.Debug().Err(err).Msg("failed to refresh stale devices, serving stale data")
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"github.com/rs/zerolog/log"
+	"html/template"
+	"net/http"
+	"path"
+	"time"
+)
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"base": path.Base,
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Truncate(time.Second).String() + " ago"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>smartmon-exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.4em 0.8em; border-bottom: 1px solid #ddd; text-align: left; }
+.health { font-weight: bold; }
+.ok { background: #d4edda; }
+.warning { background: #fff3cd; }
+.failing { background: #f8d7da; }
+.unknown { background: #e2e3e5; }
+.error { color: #a00; }
+</style>
+</head>
+<body>
+<h1>smartmon-exporter</h1>
+<p><a href="/metrics">Metrics</a> &middot; <a href="/api/v1/devices">Devices JSON</a> &middot; <a href="/api/v1/events">Events JSON</a></p>
+<table>
+<tr><th>Device</th><th>Model</th><th>Serial</th><th>Health</th><th>Temperature</th><th>Last poll</th><th>Error</th><th></th></tr>
+{{- range . }}
+<tr class="{{ .Health }}">
+<td>{{ .Device }}</td>
+<td>{{ with .Info }}{{ .ModelName }}{{ end }}</td>
+<td>{{ with .Info }}{{ .SerialNumber }}{{ end }}</td>
+<td class="health">{{ .Health }}{{ if gt .RiskScore 0.0 }} (risk {{ printf "%.2f" .RiskScore }}){{ end }}</td>
+<td>{{ with .Info }}{{ with .Temperature.Current }}{{ . }} &deg;C{{ else }}&mdash;{{ end }}{{ else }}&mdash;{{ end }}</td>
+<td title="{{ .LastPoll.Format "2006-01-02T15:04:05Z07:00" }}">{{ ago .LastPoll }}</td>
+<td class="error">{{ .LastError }}</td>
+<td><a href="/api/v1/devices/{{ base .Device }}">JSON</a> &middot; <a href="/debug/smartctl{{ .Device }}">smartctl</a></td>
+</tr>
+{{- else }}
+<tr><td colspan="8">No devices found</td></tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+// StatusHandler serves an HTML overview of all devices at the root path.
+func StatusHandler(l DeviceLister) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusTemplate.Execute(w, l.Devices()); err != nil {
+			log.Error().Err(err).Msg("failed to render status page")
+		}
+	})
+}